@@ -0,0 +1,122 @@
+package tinyrpc
+
+import (
+	"context"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/metadata"
+	"github.com/braver-braver/tinyrpc/status"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrUnauthenticated matches, with errors.Is, the errors of calls whose
+	// caller could not be authenticated.
+	ErrUnauthenticated = status.Error(codes.Unauthenticated, "tinyrpc: unauthenticated")
+	// ErrPermissionDenied matches, with errors.Is, the errors of calls the
+	// caller is not allowed to make.
+	ErrPermissionDenied = status.Error(codes.PermissionDenied, "tinyrpc: permission denied")
+)
+
+// rolePrefix marks the ACL entries that name a role rather than a principal.
+const rolePrefix = "role:"
+
+type principalKey struct{}
+
+// Principal is the authenticated caller of a call.
+type Principal struct {
+	Name  string
+	Roles []string
+}
+
+// PrincipalFromContext returns the principal the Authenticator found for the
+// call ctx belongs to.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Authenticator identifies the caller of a call from the request metadata,
+// e.g. a token, or from the peer, e.g. its client certificate. Calls it
+// returns an error for fail with codes.Unauthenticated, unless the error
+// carries a status of its own.
+type Authenticator func(ctx context.Context, md metadata.MD, p *Peer) (*Principal, error)
+
+// WithAuthenticator makes a server authenticate every call before the
+// interceptors and the handler run. Handlers find the principal with
+// PrincipalFromContext.
+func WithAuthenticator(a Authenticator) Option {
+	return func(o *options) {
+		o.authenticator = a
+	}
+}
+
+// ACL maps "Service.Method" patterns, in the syntax of path.Match, to the
+// principals allowed to call the matching methods. Entries are principal
+// names, "role:<name>" for the principals with a role, or "*" for every
+// principal. A call is allowed if any pattern matching it allows the caller,
+// calls no pattern matches are denied.
+type ACL map[string][]string
+
+// WithACL makes a server check every call against acl, calls it denies fail
+// with codes.PermissionDenied. The caller is found by the Authenticator, so
+// without one every call fails with codes.Unauthenticated.
+func WithACL(acl ACL) Option {
+	return func(o *options) {
+		o.acl = acl
+	}
+}
+
+// Allowed reports whether p may call serviceMethod.
+func (a ACL) Allowed(serviceMethod string, p *Principal) bool {
+	for pattern, entries := range a {
+		if ok, _ := path.Match(pattern, serviceMethod); !ok {
+			continue
+		}
+		for _, entry := range entries {
+			if entry == "*" || entry == p.Name {
+				return true
+			}
+			if role, ok := strings.CutPrefix(entry, rolePrefix); ok && p.hasRole(role) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *Principal) hasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize authenticates the caller of serviceMethod and checks it against
+// the ACL. It returns ctx carrying the principal.
+func (s *Server) authorize(ctx context.Context, serviceMethod string, md metadata.MD) (context.Context, error) {
+	if s.authenticator == nil && s.acl == nil {
+		return ctx, nil
+	}
+	var principal *Principal
+	if s.authenticator != nil {
+		peer, _ := PeerFromContext(ctx)
+		var err error
+		principal, err = s.authenticator(ctx, md, peer)
+		if err != nil {
+			if _, ok := status.FromError(err); ok {
+				return nil, err
+			}
+			return nil, status.Errorf(codes.Unauthenticated, "tinyrpc: unauthenticated: %v", err)
+		}
+	}
+	if principal == nil {
+		return nil, ErrUnauthenticated
+	}
+	if s.acl != nil && !s.acl.Allowed(serviceMethod, principal) {
+		return nil, status.Errorf(codes.PermissionDenied, "tinyrpc: permission denied: %s may not call %s", principal.Name, serviceMethod)
+	}
+	return context.WithValue(ctx, principalKey{}, principal), nil
+}
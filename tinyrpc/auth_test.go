@@ -0,0 +1,100 @@
+package tinyrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/braver-braver/tinyrpc/metadata"
+	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestACL_Allowed(t *testing.T) {
+	acl := ACL{
+		"Arith.Add": {"alice"},
+		"Arith.*":   {"role:admin"},
+		"*.Echo":    {"*"},
+		"[":         {"*"},
+	}
+	alice := &Principal{Name: "alice"}
+	bob := &Principal{Name: "bob", Roles: []string{"admin"}}
+	carol := &Principal{Name: "carol"}
+	cases := []struct {
+		method    string
+		principal *Principal
+		allowed   bool
+	}{
+		{"Arith.Add", alice, true},
+		{"Arith.Mul", alice, false},
+		{"Arith.Mul", bob, true},
+		{"Arith.Add", carol, false},
+		{"Arith.Echo", carol, true},
+		{"Blobs.Echo", carol, true},
+		{"Blobs.Get", bob, false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.allowed, acl.Allowed(c.method, c.principal), "%s calling %s", c.principal.Name, c.method)
+	}
+}
+
+func TestServer_Authorization(t *testing.T) {
+	principals := map[string]*Principal{
+		"alice-token": {Name: "alice"},
+		"bob-token":   {Name: "bob", Roles: []string{"admin"}},
+	}
+	authenticate := func(ctx context.Context, md metadata.MD, p *Peer) (*Principal, error) {
+		if p == nil || p.Addr == nil {
+			return nil, errors.New("no peer")
+		}
+		principal, ok := principals[md["token"]]
+		if !ok {
+			return nil, errors.New("bad token")
+		}
+		return principal, nil
+	}
+	var seen []string
+	record := func(ctx context.Context, serviceMethod string, args, reply any, invoker UnaryInvoker) error {
+		p, _ := PrincipalFromContext(ctx)
+		seen = append(seen, p.Name)
+		return invoker(ctx, serviceMethod, args, reply)
+	}
+	s, addr, _ := startServer(t, &Arith{},
+		WithAuthenticator(authenticate),
+		WithACL(ACL{"Arith.Add": {"alice"}, "Arith.*": {"role:admin"}}),
+		WithUnaryInterceptor(record))
+	defer s.Close()
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	cases := []struct {
+		token  string
+		method string
+		err    error
+	}{
+		{"", "Arith.Add", ErrUnauthenticated},
+		{"eve-token", "Arith.Add", ErrUnauthenticated},
+		{"alice-token", "Arith.Add", nil},
+		{"alice-token", "Arith.Mul", ErrPermissionDenied},
+		{"bob-token", "Arith.Mul", nil},
+	}
+	for _, c := range cases {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "token", c.token)
+		err := client.CallContext(ctx, c.method, &message.ArithRequest{A: 2, B: 3}, &message.ArithResponse{})
+		if c.err == nil {
+			assert.NoError(t, err, "%s calling %s", c.token, c.method)
+		} else {
+			assert.ErrorIs(t, err, c.err, "%s calling %s", c.token, c.method)
+		}
+	}
+	// the interceptors only see the allowed calls
+	assert.Equal(t, []string{"alice", "bob"}, seen)
+
+	// an ACL without an authenticator lets nobody in
+	s, addr, _ = startServer(t, &Arith{}, WithACL(ACL{"*": {"*"}}))
+	defer s.Close()
+	client = dialClient(t, addr)
+	defer client.Close()
+	err := client.Call("Arith.Add", &message.ArithRequest{A: 2, B: 3}, &message.ArithResponse{})
+	assert.ErrorIs(t, err, ErrUnauthenticated)
+}
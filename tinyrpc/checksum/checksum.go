@@ -0,0 +1,58 @@
+package checksum
+
+import (
+	"github.com/cespare/xxhash/v2"
+	"hash/crc32"
+)
+
+// Type is the algorithm that checksums the body of a call.
+type Type uint16
+
+const (
+	// IEEE is CRC-32 with the IEEE polynomial. It is the zero value, as it is
+	// what peers that don't send a checksum type use.
+	IEEE Type = iota
+	// None sends no checksum.
+	None
+	// CRC32C is CRC-32 with the Castagnoli polynomial, which most CPUs compute
+	// in hardware.
+	CRC32C
+	// XXHash64 is the full 64-bit xxHash64, the header carries its high
+	// half as an extension.
+	XXHash64
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Valid reports whether t is a known algorithm.
+func (t Type) Valid() bool {
+	return t <= XXHash64
+}
+
+// Sum returns the checksum of data, 0 for None. Only XXHash64 uses the high
+// 32 bits.
+func (t Type) Sum(data []byte) uint64 {
+	switch t {
+	case IEEE:
+		return uint64(crc32.ChecksumIEEE(data))
+	case CRC32C:
+		return uint64(crc32.Checksum(data, castagnoli))
+	case XXHash64:
+		return xxhash.Sum64(data)
+	}
+	return 0
+}
+
+func (t Type) String() string {
+	switch t {
+	case IEEE:
+		return "ieee"
+	case None:
+		return "none"
+	case CRC32C:
+		return "crc32c"
+	case XXHash64:
+		return "xxhash64"
+	}
+	return "unknown"
+}
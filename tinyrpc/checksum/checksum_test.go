@@ -0,0 +1,41 @@
+package checksum
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestType_Sum(t *testing.T) {
+	data := []byte("123456789")
+	cases := []struct {
+		name   string
+		t      Type
+		expect uint64
+	}{
+		{"ieee", IEEE, 0xcbf43926},
+		{"crc32c", CRC32C, 0xe3069283},
+		{"xxhash64", XXHash64, 0x8cb841db40e6ae83},
+		{"none", None, 0},
+		{"unknown", 0xff, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, c.t.Sum(data))
+			assert.Equal(t, c.name, c.t.String())
+		})
+	}
+	// the reference xxHash64 of no data
+	assert.Equal(t, uint64(0xef46db3751d8e999), XXHash64.Sum(nil))
+}
+
+func BenchmarkType_Sum(b *testing.B) {
+	data := make([]byte, 64<<10)
+	for _, t := range []Type{IEEE, CRC32C, XXHash64} {
+		b.Run(t.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				t.Sum(data)
+			}
+		})
+	}
+}
@@ -1,15 +1,73 @@
 package tinyrpc
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"github.com/braver-braver/tinyrpc/codec"
+	"github.com/braver-braver/tinyrpc/codes"
 	"github.com/braver-braver/tinyrpc/compressor"
+	"github.com/braver-braver/tinyrpc/header"
+	"github.com/braver-braver/tinyrpc/metadata"
 	"github.com/braver-braver/tinyrpc/serializer"
+	"github.com/braver-braver/tinyrpc/status"
 	"io"
-	"net/rpc"
+	"log"
+	"net"
+	"sync"
+	"time"
 )
 
+// ErrShutdown is returned by calls on a client that is closed. Calls on a
+// client whose connection broke fail with codes.Unavailable.
+var ErrShutdown = errors.New("tinyrpc: connection is shut down")
+
+// Call represents an active rpc.
+type Call struct {
+	ServiceMethod string      // The name of the service and method to call.
+	Args          any         // The argument to the function (*struct).
+	Reply         any         // The reply from the function (*struct).
+	Error         error       // After completion, the error status.
+	Done          chan *Call  // Receives *Call when Go is complete.
+	Trailer       metadata.MD // The trailer sent by the server, after completion.
+
+	ctx context.Context
+	seq uint64
+}
+
+func (call *Call) done() {
+	select {
+	case call.Done <- call:
+	default:
+		// We don't want to block here. It is the caller's responsibility to make
+		// sure the channel has enough buffer space.
+	}
+}
+
 type Client struct {
-	*rpc.Client
+	codec        codec.ClientCodec // the connection, replaced by reconnects
+	interceptor  UnaryInterceptor
+	streamWindow int
+	options      options
+	// dial opens a new connection, it is nil for the clients of NewClient,
+	// which don't reconnect.
+	dial func() (io.ReadWriteCloser, error)
+	done chan struct{} // closed by Close
+
+	reqMutex sync.Mutex // protects following
+	request  codec.Request
+
+	mutex        sync.Mutex // protects following
+	seq          uint64
+	pending      map[uint64]*Call
+	streams      map[uint64]*ClientStream
+	state        ConnectivityState
+	stateChanged chan struct{} // closed on every change of state
+	lost         error         // why the client hung up on its own
+	closing      bool          // user has called Close
+	shutdown     bool          // there is no connection
+	err          error         // why the last connection failed or broke
 }
 
 // WithCompress set client compression format
@@ -19,32 +77,613 @@ func WithCompress(c compressor.CompressType) Option {
 	}
 }
 
-// WithSerializer set client serializer
+// WithMinCompressSize sets the body size in bytes below which a client or
+// server sends bodies uncompressed even if a compressor is set.
+func WithMinCompressSize(size int) Option {
+	return func(o *options) {
+		o.minCompressSize = size
+	}
+}
+
+// WithSerializer set client serializer. It takes a serializer.SerializeType
+// such as serializer.JSON, or a serializer of the same type as a registered
+// one, see serializer.RegisterSerializer; the client fails to connect with
+// others.
 func WithSerializer(serializer serializer.Serializer) Option {
 	return func(o *options) {
 		o.serializer = serializer
 	}
 }
 
-// NewClient Create a new rpc client
+// WithTLS makes Dial connect over TLS with config. To authenticate with a
+// client certificate, set Certificates in config.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// Dial connects to the server at the TCP address addr, over TLS if WithTLS is
+// given, and returns the client once the first attempt is over. If it
+// failed, or when the connection breaks later on, the calls in flight fail
+// with codes.Unavailable and the client redials in the background, backing
+// off between the attempts, see WithBackoff. Calls made meanwhile fail with
+// codes.Unavailable as well, callers that rather wait use WaitForReady. Dial
+// only fails if the options can't be used, e.g. with an unknown serializer.
+func Dial(addr string, opts ...Option) (*Client, error) {
+	c := newClient(opts)
+	if _, ok := serializer.TypeOf(c.options.serializer); !ok {
+		return nil, codec.NotFoundSerializerError
+	}
+	c.dial = func() (io.ReadWriteCloser, error) {
+		dialer := &net.Dialer{Timeout: handshakeTimeout}
+		if c.options.tlsConfig != nil {
+			return tls.DialWithDialer(dialer, "tcp", addr, c.options.tlsConfig)
+		}
+		return dialer.Dial("tcp", addr)
+	}
+	if !c.redial() {
+		go c.backoff()
+	}
+	return c, nil
+}
+
+// NewClient Create a new rpc client. It runs the handshake on conn first, if
+// the server refuses the client's parameters, the connection is closed and
+// every call fails with the reason. The client can't reconnect, once conn
+// breaks every call fails, use Dial for a client that redials.
 func NewClient(conn io.ReadWriteCloser, opts ...Option) *Client {
-	options := options{
-		compressType: compressor.Raw,
-		serializer:   serializer.Proto,
+	c := newClient(opts)
+	if err := c.connect(conn); err != nil {
+		c.err = err
+		c.state = Shutdown
 	}
+	return c
+}
+
+func newClient(opts []Option) *Client {
+	options := defaultOptions()
 	for _, option := range opts {
 		option(&options)
 	}
-	return &Client{rpc.NewClientWithCodec(
-		codec.NewClientCodec(conn, options.compressType, options.serializer))}
+	return &Client{
+		interceptor:  chainUnaryInterceptors(options.interceptors),
+		streamWindow: options.streamWindow,
+		options:      options,
+		done:         make(chan struct{}),
+		pending:      make(map[uint64]*Call),
+		streams:      make(map[uint64]*ClientStream),
+		state:        Idle,
+		stateChanged: make(chan struct{}),
+		shutdown:     true,
+	}
+}
+
+// connect runs the handshake on conn and makes it the connection of the
+// client.
+func (c *Client) connect(conn io.ReadWriteCloser) error {
+	options := &c.options
+	serializeType, ok := serializer.TypeOf(options.serializer)
+	err := handshake(conn, func() error {
+		if !ok {
+			return codec.NotFoundSerializerError
+		}
+		_, err := codec.ClientHandshake(conn, options.compressType, serializeType)
+		return err
+	})
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("tinyrpc: handshake failed: %w", err)
+	}
+	cc := codec.NewClientCodec(conn, options.compressType, serializeType, options.codecOptions()...)
+	alive := newKeepalive(options.keepaliveInterval, options.keepaliveTimeout, options.idleTimeout)
+	closed := make(chan struct{})
+
+	c.reqMutex.Lock()
+	c.mutex.Lock()
+	if c.closing {
+		c.mutex.Unlock()
+		c.reqMutex.Unlock()
+		_ = conn.Close()
+		return ErrShutdown
+	}
+	c.codec = cc
+	c.shutdown = false
+	c.err = nil
+	c.setStateLocked(Ready)
+	c.mutex.Unlock()
+	c.reqMutex.Unlock()
+
+	go c.input(cc, alive, closed)
+	go alive.run(closed, c.busy, c.ping, func(reason error) {
+		c.hangUp(cc, reason)
+	})
+	return nil
 }
 
 // Call synchronously calls the rpc function
 func (c *Client) Call(serviceMethod string, args interface{}, reply interface{}) error {
-	return c.Client.Call(serviceMethod, args, reply)
+	return c.CallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// CallContext synchronously calls the rpc function. The deadline and the
+// outgoing metadata of ctx are sent to the server, which attaches them to the
+// handler's context. If ctx is done before the reply arrives, CallContext
+// returns ctx.Err(), the server is told to cancel the handler's context and
+// a late reply is discarded.
+func (c *Client) CallContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) error {
+	return c.intercept(ctx, serviceMethod, args, reply, nil)
+}
+
+// Notify calls serviceMethod without waiting for it, the server runs the call
+// but sends no reply back. The returned error only tells whether the request
+// could be sent.
+func (c *Client) Notify(serviceMethod string, args any) error {
+	return c.NotifyContext(context.Background(), serviceMethod, args)
+}
+
+// NotifyContext is Notify with the deadline and the outgoing metadata of ctx
+// sent along. Interceptors run for notifications too, with a nil reply.
+func (c *Client) NotifyContext(ctx context.Context, serviceMethod string, args any) error {
+	if c.interceptor == nil {
+		return c.notify(ctx, serviceMethod, args, nil)
+	}
+	return c.interceptor(ctx, serviceMethod, args, nil, c.notify)
+}
+
+// notify sends a one-way request.
+func (c *Client) notify(ctx context.Context, serviceMethod string, args, _ any) error {
+	if err := c.awaitConn(ctx); err != nil {
+		return err
+	}
+	req := &codec.Request{ServiceMethod: serviceMethod, Type: header.FrameOneWay}
+	req.Metadata, _ = metadata.FromOutgoingContext(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		if req.Timeout = time.Until(deadline); req.Timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+	}
+
+	c.mutex.Lock()
+	if c.shutdown || c.closing {
+		err := ErrShutdown
+		if c.err != nil {
+			err = c.err
+		}
+		c.mutex.Unlock()
+		return err
+	}
+	req.Seq = c.seq
+	c.seq++
+	c.mutex.Unlock()
+	return c.writeFrame(req, args)
+}
+
+// intercept runs the interceptors around invoke. The trailer of the call is
+// stored in trailer if it is not nil.
+func (c *Client) intercept(ctx context.Context, serviceMethod string, args, reply any, trailer *metadata.MD) error {
+	invoker := func(ctx context.Context, serviceMethod string, args, reply any) error {
+		return c.invoke(ctx, serviceMethod, args, reply, trailer)
+	}
+	if c.interceptor == nil {
+		return invoker(ctx, serviceMethod, args, reply)
+	}
+	return c.interceptor(ctx, serviceMethod, args, reply, invoker)
+}
+
+// invoke sends a call and waits until it completes or ctx is done.
+func (c *Client) invoke(ctx context.Context, serviceMethod string, args, reply any, trailer *metadata.MD) error {
+	call := c.newCall(ctx, serviceMethod, args, reply, make(chan *Call, 1))
+	c.start(call)
+	select {
+	case <-call.Done:
+	case <-ctx.Done():
+		if c.abandon(call) {
+			c.cancel(call.seq)
+			return ctx.Err()
+		}
+		// the reply is being decoded right now, wait for it.
+		<-call.Done
+	}
+	if trailer != nil {
+		*trailer = call.Trailer
+	}
+	return call.Error
+}
+
+// AsyncCall asynchronously calls the rpc function and returns a channel of *Call
+func (c *Client) AsyncCall(serviceMethod string, args interface{}, reply interface{}) chan *Call {
+	return c.AsyncCallContext(context.Background(), serviceMethod, args, reply)
+}
+
+// AsyncCallContext is AsyncCall with a context, the call is cancelled like
+// one of CallContext once ctx is done.
+func (c *Client) AsyncCallContext(ctx context.Context, serviceMethod string, args interface{}, reply interface{}) chan *Call {
+	return c.Go(ctx, serviceMethod, args, reply, nil).Done
+}
+
+// Go invokes the function asynchronously. It returns the Call structure
+// representing the invocation. The done channel will signal when the call is
+// complete by returning the same Call object. If done is nil, Go will allocate
+// a new channel. If non-nil, done must be buffered or Go will deliberately
+// crash. The trailer set by the handler is available in Call.Trailer. The
+// call is cancelled like one of CallContext once ctx is done.
+func (c *Client) Go(ctx context.Context, serviceMethod string, args any, reply any, done chan *Call) *Call {
+	if done == nil {
+		done = make(chan *Call, 10) // buffered.
+	} else if cap(done) == 0 {
+		log.Panic("tinyrpc: done channel is unbuffered")
+	}
+	call := c.newCall(ctx, serviceMethod, args, reply, done)
+	if c.interceptor == nil && ctx.Done() == nil {
+		c.start(call)
+		return call
+	}
+	// interceptors need to see the outcome of the call and ctx has to be
+	// watched, so run the call in the background.
+	go func() {
+		call.Error = c.intercept(ctx, serviceMethod, args, reply, &call.Trailer)
+		call.done()
+	}()
+	return call
 }
 
-// AsyncCall asynchronously calls the rpc function and returns a channel of *rpc.Call
-func (c *Client) AsyncCall(serviceMethod string, args interface{}, reply interface{}) chan *rpc.Call {
-	return c.Go(serviceMethod, args, reply, nil).Done
+func (c *Client) newCall(ctx context.Context, serviceMethod string, args, reply any, done chan *Call) *Call {
+	return &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		Reply:         reply,
+		Done:          done,
+		ctx:           ctx,
+	}
+}
+
+// start sends the call unless its context is already done, once the client
+// is done connecting.
+func (c *Client) start(call *Call) {
+	if err := c.awaitConn(call.ctx); err != nil {
+		call.Error = err
+		call.done()
+		return
+	}
+	c.send(call)
+}
+
+func (c *Client) send(call *Call) {
+	c.reqMutex.Lock()
+	defer c.reqMutex.Unlock()
+
+	// Register this call.
+	c.mutex.Lock()
+	if c.shutdown || c.closing {
+		call.Error = ErrShutdown
+		if c.err != nil {
+			call.Error = c.err
+		}
+		c.mutex.Unlock()
+		call.done()
+		return
+	}
+	seq := c.seq
+	c.seq++
+	call.seq = seq
+	c.pending[seq] = call
+	c.mutex.Unlock()
+
+	// Encode and send the request.
+	c.request.Seq = seq
+	c.request.ServiceMethod = call.ServiceMethod
+	c.request.Timeout = 0
+	c.request.Metadata, _ = metadata.FromOutgoingContext(call.ctx)
+	if deadline, ok := call.ctx.Deadline(); ok {
+		c.request.Timeout = time.Until(deadline)
+		if c.request.Timeout <= 0 {
+			c.removeCall(seq)
+			call.Error = context.DeadlineExceeded
+			call.done()
+			return
+		}
+	}
+	if err := c.codec.WriteRequest(&c.request, call.Args); err != nil {
+		if call = c.removeCall(seq); call != nil {
+			call.Error = err
+			call.done()
+		}
+	}
+}
+
+func (c *Client) removeCall(seq uint64) *Call {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	call := c.pending[seq]
+	delete(c.pending, seq)
+	return call
+}
+
+// cancel tells the server to cancel the call or the stream seq, which is no
+// longer waited for.
+func (c *Client) cancel(seq uint64) {
+	err := c.writeFrame(&codec.Request{Seq: seq, Type: header.FrameCancel}, nil)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("tinyrpc: sending cancel: %v", err)
+	}
+}
+
+// abandon removes call from the pending calls, so that its reply is
+// discarded. It reports false if the call is not pending anymore.
+func (c *Client) abandon(call *Call) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.pending[call.seq] != call {
+		return false
+	}
+	delete(c.pending, call.seq)
+	return true
+}
+
+// input reads the responses of the connection cc until it breaks.
+func (c *Client) input(cc codec.ClientCodec, alive *keepalive, closed chan struct{}) {
+	var err error
+	var response codec.Response
+	for err == nil {
+		response = codec.Response{}
+		err = cc.ReadResponseHeader(&response)
+		if err != nil {
+			break
+		}
+		alive.read()
+		if response.Type != header.FrameUnary {
+			err = c.streamFrame(cc, &response)
+			continue
+		}
+		call := c.removeCall(response.Seq)
+		if call != nil {
+			call.Trailer = response.Metadata
+		}
+
+		switch {
+		case call == nil:
+			// We've got no pending call. That usually means that
+			// WriteRequest partially failed, or the caller gave up on the
+			// call; either way the body has to be discarded.
+			err = cc.ReadResponseBody(nil)
+		case response.Error != "" || response.Code != codes.OK:
+			code := response.Code
+			if code == codes.OK {
+				// the server doesn't send codes
+				code = codes.Unknown
+			}
+			call.Error = status.FromRaw(code, response.Error, response.Details).Err()
+			err = cc.ReadResponseBody(nil)
+			call.done()
+		default:
+			err = cc.ReadResponseBody(call.Reply)
+			if err != nil {
+				call.Error = fmt.Errorf("reading body: %w", err)
+				if !errors.Is(err, codec.BodyTooLargeError) {
+					// the body was read, only this call fails. Errors of
+					// the connection come up again with the next header.
+					err = nil
+				}
+			}
+			call.done()
+		}
+	}
+	if errors.Is(err, codec.HeaderTooLargeError) || errors.Is(err, codec.BodyTooLargeError) {
+		// the stream is out of sync, hang up.
+		_ = cc.Close()
+	}
+	// Terminate pending calls.
+	c.reqMutex.Lock()
+	c.mutex.Lock()
+	c.shutdown = true
+	lost := c.lost
+	c.lost = nil
+	if c.closing {
+		err = ErrShutdown
+	} else {
+		// either end closed the connection as nothing was going on
+		idle := lost == errIdleTimeout ||
+			lost == nil && err == io.EOF && len(c.pending) == 0 && len(c.streams) == 0
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if lost != nil {
+			err = lost
+		}
+		err = status.Errorf(codes.Unavailable, "tinyrpc: connection lost: %v", err)
+		c.err = err
+		switch {
+		case c.dial == nil:
+			c.setStateLocked(Shutdown)
+		case idle:
+			// reconnect once there is a call to make
+			c.setStateLocked(Idle)
+		default:
+			c.setStateLocked(TransientFailure)
+			go c.reconnect()
+		}
+	}
+	close(closed)
+	for _, call := range c.pending {
+		call.Error = err
+		call.done()
+	}
+	for _, cs := range c.streams {
+		cs.closeRecv(err)
+		cs.finish()
+	}
+	c.pending = make(map[uint64]*Call)
+	c.streams = make(map[uint64]*ClientStream)
+	c.mutex.Unlock()
+	c.reqMutex.Unlock()
+}
+
+// Close calls the underlying codec's Close method. If the connection is already
+// shutting down, ErrShutdown is returned. A client without a connection, as
+// it lost or never got one, closes without an error.
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	if c.closing {
+		c.mutex.Unlock()
+		return ErrShutdown
+	}
+	c.closing = true
+	close(c.done)
+	c.setStateLocked(Shutdown)
+	cc := c.codec
+	if c.shutdown {
+		cc = nil
+	}
+	c.mutex.Unlock()
+	if cc == nil {
+		return nil
+	}
+	return cc.Close()
+}
+
+// NewStream opens a stream to serviceMethod, a method of the server taking
+// a *ServerStream. The deadline and the outgoing metadata of ctx are sent
+// like those of a unary call, the stream is cancelled once ctx is done.
+// Interceptors don't run for streams.
+func (c *Client) NewStream(ctx context.Context, serviceMethod string) (*ClientStream, error) {
+	if err := c.awaitConn(ctx); err != nil {
+		return nil, err
+	}
+	req := &codec.Request{ServiceMethod: serviceMethod, Type: header.FrameStreamOpen}
+	req.Metadata, _ = metadata.FromOutgoingContext(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		if req.Timeout = time.Until(deadline); req.Timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+
+	c.mutex.Lock()
+	if c.shutdown || c.closing {
+		err := ErrShutdown
+		if c.err != nil {
+			err = c.err
+		}
+		c.mutex.Unlock()
+		return nil, err
+	}
+	cs := &ClientStream{client: c, id: c.seq}
+	c.seq++
+	cs.stream = newStream(ctx, c.streamWindow, func(typ header.FrameType, window uint32, msg any) error {
+		return c.writeFrame(&codec.Request{Seq: cs.id, Type: typ, Window: window}, msg)
+	})
+	c.streams[cs.id] = cs
+	c.mutex.Unlock()
+
+	req.Seq = cs.id
+	req.Window = uint32(cs.window)
+	if err := c.writeFrame(req, nil); err != nil {
+		c.removeStream(cs.id)
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			if c.removeStream(cs.id) != nil {
+				c.cancel(cs.id)
+			}
+		case <-cs.done:
+		}
+	}()
+	return cs, nil
+}
+
+// writeFrame writes a frame of a stream.
+func (c *Client) writeFrame(req *codec.Request, msg any) error {
+	c.reqMutex.Lock()
+	defer c.reqMutex.Unlock()
+	return c.codec.WriteRequest(req, msg)
+}
+
+// removeStream forgets a stream, its frames are discarded from then on.
+func (c *Client) removeStream(id uint64) *ClientStream {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cs := c.streams[id]
+	delete(c.streams, id)
+	if cs != nil {
+		cs.finish()
+	}
+	return cs
+}
+
+// streamFrame hands a frame read by input other than a reply to its stream,
+// or answers it if it is a ping. It returns the errors that break the
+// connection.
+func (c *Client) streamFrame(cc codec.ClientCodec, response *codec.Response) error {
+	switch response.Type {
+	case header.FramePing:
+		// answer from another goroutine, the reader mustn't wait for writes
+		go c.pong(response.Seq)
+		return cc.ReadResponseBody(nil)
+	case header.FramePong:
+		return cc.ReadResponseBody(nil)
+	}
+	c.mutex.Lock()
+	cs := c.streams[response.Seq]
+	c.mutex.Unlock()
+	if cs == nil {
+		return cc.ReadResponseBody(nil)
+	}
+	switch response.Type {
+	case header.FrameStreamMessage:
+		m := &codec.Message{}
+		if err := cc.ReadResponseBody(m); err != nil {
+			cs.closeRecv(fmt.Errorf("reading body: %w", err))
+			c.removeStream(cs.id)
+			if errors.Is(err, codec.BodyTooLargeError) {
+				return err
+			}
+			return nil
+		}
+		cs.deliver(m)
+		return nil
+	case header.FrameWindowUpdate:
+		cs.grant(response.Window)
+	case header.FrameStreamEnd:
+		c.removeStream(cs.id)
+		cs.mu.Lock()
+		cs.trailer = response.Metadata
+		cs.mu.Unlock()
+		var err error
+		if response.Error != "" || response.Code != codes.OK {
+			err = status.FromRaw(response.Code, response.Error, response.Details).Err()
+		}
+		cs.closeRecv(err)
+	}
+	return cc.ReadResponseBody(nil)
+}
+
+// busy reports whether calls or streams are in flight.
+func (c *Client) busy() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.pending) > 0 || len(c.streams) > 0
+}
+
+func (c *Client) ping() error {
+	return c.writeFrame(&codec.Request{Type: header.FramePing}, nil)
+}
+
+func (c *Client) pong(seq uint64) {
+	err := c.writeFrame(&codec.Request{Seq: seq, Type: header.FramePong}, nil)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("tinyrpc: writing pong: %v", err)
+	}
+}
+
+// hangUp closes the connection cc for reason, the calls in flight fail with
+// it.
+func (c *Client) hangUp(cc codec.ClientCodec, reason error) {
+	c.mutex.Lock()
+	if c.codec == cc {
+		c.lost = reason
+	}
+	c.mutex.Unlock()
+	_ = cc.Close()
 }
@@ -0,0 +1,309 @@
+package tinyrpc
+
+import (
+	"context"
+	"github.com/braver-braver/tinyrpc/codec"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/compressor"
+	"github.com/braver-braver/tinyrpc/metadata"
+	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/braver-braver/tinyrpc/serializer"
+	"github.com/braver-braver/tinyrpc/status"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient_Call(t *testing.T) {
+	s, addr, _ := startServer(t, &Arith{})
+	defer s.Close()
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+	assert.Equal(t, float64(3), reply.C)
+
+	assert.NoError(t, client.Call("Arith.Mul", &message.ArithRequest{A: 2, B: 3}, reply))
+	assert.Equal(t, float64(6), reply.C)
+
+	err := client.Call("Arith.Pow", &message.ArithRequest{A: 2, B: 3}, reply)
+	assert.Equal(t, status.Error(codes.Unimplemented, "tinyrpc: can't find method Arith.Pow"), err)
+}
+
+func TestClient_Status(t *testing.T) {
+	s, addr, _ := startServer(t, &Arith{})
+	defer s.Close()
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	args := &message.ArithRequest{A: 1}
+	err := client.Call("Arith.Div", args, &message.ArithResponse{})
+	assert.ErrorIs(t, err, status.Error(codes.InvalidArgument, ""))
+	assert.NotErrorIs(t, err, status.Error(codes.Internal, ""))
+	var ce *status.CallError
+	if assert.ErrorAs(t, err, &ce) {
+		assert.Equal(t, "divide by zero", ce.Status().Message())
+		details := ce.Status().Details()
+		if assert.Len(t, details, 1) {
+			assert.True(t, proto.Equal(args, details[0].(proto.Message)))
+		}
+	}
+
+	err = client.Call("Nope.Add", &message.ArithRequest{}, &message.ArithResponse{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestClient_Notify(t *testing.T) {
+	type served struct {
+		method string
+		reply  float64
+		err    error
+	}
+	calls := make(chan served, 2)
+	s, addr, _ := startServer(t, &Arith{}, WithUnaryInterceptor(
+		func(ctx context.Context, serviceMethod string, args, reply any, invoker UnaryInvoker) error {
+			err := invoker(ctx, serviceMethod, args, reply)
+			calls <- served{serviceMethod, reply.(*message.ArithResponse).C, err}
+			return err
+		}))
+	defer s.Close()
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	assert.NoError(t, client.Notify("Arith.Add", &message.ArithRequest{A: 1, B: 2}))
+	assert.Equal(t, served{"Arith.Add", 3, nil}, <-calls)
+	assert.NoError(t, client.Notify("Arith.Div", &message.ArithRequest{A: 1}))
+	assert.Equal(t, codes.InvalidArgument, status.Code((<-calls).err))
+
+	// no reply came back for the notifications
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Mul", &message.ArithRequest{A: 2, B: 3}, reply))
+	assert.Equal(t, float64(6), reply.C)
+	<-calls
+
+	client.Close()
+	assert.ErrorIs(t, client.Notify("Arith.Add", &message.ArithRequest{}), ErrShutdown)
+}
+
+func TestClient_CallContext(t *testing.T) {
+	arith := &Arith{deadlines: make(chan time.Time, 1)}
+	s, addr, _ := startServer(t, arith)
+	defer s.Close()
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	clientDeadline, _ := ctx.Deadline()
+	err := client.CallContext(ctx, "Arith.Wait", &message.ArithRequest{}, &message.ArithResponse{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	serverDeadline := <-arith.deadlines
+	assert.WithinDuration(t, clientDeadline, serverDeadline, 50*time.Millisecond)
+
+	// the client keeps working after a call timed out
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+	assert.Equal(t, float64(3), reply.C)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = client.CallContext(ctx, "Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestClient_Cancel(t *testing.T) {
+	arith := &Arith{deadlines: make(chan time.Time, 1), waited: make(chan error, 1)}
+	s, addr, _ := startServer(t, arith)
+	defer s.Close()
+	assert.NoError(t, s.Register(&Feed{}))
+	client := dialClient(t, addr)
+	defer client.Close()
+	idle := func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for c := range s.conns {
+			if c.active.Load() != 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	// the handler of an abandoned call is cancelled, it has no deadline
+	ctx, cancel := context.WithCancel(context.Background())
+	call := client.Go(ctx, "Arith.Wait", &message.ArithRequest{}, &message.ArithResponse{}, nil)
+	<-arith.deadlines
+	cancel()
+	assert.ErrorIs(t, (<-call.Done).Error, context.Canceled)
+	assert.ErrorIs(t, <-arith.waited, context.Canceled)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	done := client.AsyncCallContext(ctx, "Arith.Wait", &message.ArithRequest{}, &message.ArithResponse{})
+	<-arith.deadlines
+	cancel()
+	assert.ErrorIs(t, (<-done).Error, context.Canceled)
+	assert.ErrorIs(t, <-arith.waited, context.Canceled)
+
+	// so is the handler of an abandoned stream
+	ctx, cancel = context.WithCancel(context.Background())
+	_, err := client.NewStream(ctx, "Feed.Sum")
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return !idle() }, time.Second, time.Millisecond)
+	cancel()
+	assert.Eventually(t, idle, time.Second, time.Millisecond)
+
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+	assert.Equal(t, float64(3), reply.C)
+}
+
+func TestClient_Metadata(t *testing.T) {
+	s, addr, _ := startServer(t, &Arith{})
+	defer s.Close()
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("tenant", "acme"))
+	call := <-client.Go(ctx, "Arith.Echo", &message.ArithRequest{}, &message.ArithResponse{}, nil).Done
+	assert.NoError(t, call.Error)
+	assert.Equal(t, metadata.MD{"tenant": "acme", "load": "0.5"}, call.Trailer)
+
+	call = <-client.Go(context.Background(), "Arith.Add", &message.ArithRequest{}, &message.ArithResponse{}, nil).Done
+	assert.NoError(t, call.Error)
+	assert.Nil(t, call.Trailer)
+
+	assert.Error(t, SetTrailer(context.Background(), metadata.Pairs("k", "v")))
+}
+
+func TestClient_Handshake(t *testing.T) {
+	s, addr, _ := startServer(t, &Arith{})
+	defer s.Close()
+
+	client := dialClient(t, addr, WithCompress(compressor.Snappy))
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+	assert.Equal(t, float64(3), reply.C)
+	assert.NoError(t, client.Close())
+
+	client = dialClient(t, addr, WithCompress(0xff))
+	err := client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply)
+	assert.ErrorIs(t, err, codec.NotFoundCompressorError)
+
+	// the server hangs up on peers that don't speak tinyrpc
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+	assert.NoError(t, err)
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+}
+
+func TestClient_Serializer(t *testing.T) {
+	s, addr, _ := startServer(t, &Arith{})
+	defer s.Close()
+
+	for _, st := range []serializer.SerializeType{serializer.Proto, serializer.JSON} {
+		client := dialClient(t, addr, WithSerializer(st))
+		reply := &message.ArithResponse{}
+		assert.NoError(t, client.Call("Arith.Mul", &message.ArithRequest{A: 2, B: 3}, reply))
+		assert.Equal(t, float64(6), reply.C)
+		assert.NoError(t, client.Close())
+	}
+
+	// serializers are accepted too, if they are registered
+	for _, s := range []serializer.Serializer{serializer.JSONSerializer{}, serializer.MsgPackSerializer{}} {
+		client := dialClient(t, addr, WithSerializer(s))
+		reply := &message.ArithResponse{}
+		assert.NoError(t, client.Call("Arith.Mul", &message.ArithRequest{A: 2, B: 3}, reply))
+		assert.Equal(t, float64(6), reply.C)
+		assert.NoError(t, client.Close())
+	}
+	client := dialClient(t, addr, WithSerializer(&serializer.ProtoSerializer{}))
+	err := client.Call("Arith.Mul", &message.ArithRequest{A: 2, B: 3}, &message.ArithResponse{})
+	assert.ErrorIs(t, err, codec.NotFoundSerializerError)
+}
+
+func TestClient_Compressors(t *testing.T) {
+	s, addr, _ := startServer(t, &Arith{})
+	defer s.Close()
+
+	for ct := range compressor.Compressors {
+		client := dialClient(t, addr, WithCompress(ct))
+		reply := &message.ArithResponse{}
+		assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 2, B: 3}, reply), "compressor %d", ct)
+		assert.Equal(t, float64(5), reply.C)
+		assert.NoError(t, client.Close())
+	}
+}
+
+type Blob struct {
+	Data []byte
+}
+
+// Blobs echoes plain structs, so that tests can pick the message size.
+type Blobs struct{}
+
+func (Blobs) Echo(ctx context.Context, args *Blob, reply *Blob) error {
+	reply.Data = args.Data
+	return nil
+}
+
+func TestClient_MaxMessageSize(t *testing.T) {
+	s, addr, _ := startServer(t, Blobs{}, WithMaxMessageSize(64<<10))
+	defer s.Close()
+
+	// a highly compressible body passes the wire easily, but is turned down
+	// once it gets too large while being decompressed.
+	client := dialClient(t, addr, WithSerializer(serializer.MsgPack), WithCompress(compressor.Gzip), WithMaxMessageSize(0))
+	defer client.Close()
+	reply := &Blob{}
+	err := client.Call("Blobs.Echo", &Blob{Data: make([]byte, 1<<20)}, reply)
+	assert.ErrorContains(t, err, compressor.MessageTooLargeError.Error())
+	assert.NoError(t, client.Call("Blobs.Echo", &Blob{Data: make([]byte, 32<<10)}, reply))
+	assert.Len(t, reply.Data, 32<<10)
+
+	client = dialClient(t, addr, WithSerializer(serializer.MsgPack), WithCompress(compressor.Gzip), WithMaxMessageSize(16<<10))
+	defer client.Close()
+	err = client.Call("Blobs.Echo", &Blob{Data: make([]byte, 32<<10)}, reply)
+	assert.ErrorIs(t, err, compressor.MessageTooLargeError)
+
+	// only the call with the oversized reply fails, the others carry on
+	arith := &Arith{block: make(chan struct{})}
+	assert.NoError(t, s.Register(arith))
+	sum := &message.ArithResponse{}
+	call := client.Go(context.Background(), "Arith.Add", &message.ArithRequest{A: 1, B: 2}, sum, nil)
+	err = client.Call("Blobs.Echo", &Blob{Data: make([]byte, 32<<10)}, reply)
+	assert.ErrorIs(t, err, compressor.MessageTooLargeError)
+	close(arith.block)
+	assert.NoError(t, (<-call.Done).Error)
+	assert.Equal(t, float64(3), sum.C)
+}
+
+func TestClient_MaxFrameSize(t *testing.T) {
+	s, addr, _ := startServer(t, Blobs{}, WithMaxBodySize(4<<10), WithMaxHeaderSize(1<<10))
+	defer s.Close()
+	big := &Blob{Data: make([]byte, 8<<10)}
+
+	// the server answers the oversized call, then hangs up
+	client := dialClient(t, addr, WithSerializer(serializer.MsgPack))
+	err := client.Call("Blobs.Echo", big, &Blob{})
+	assert.ErrorContains(t, err, codec.BodyTooLargeError.Error())
+	assert.Error(t, client.Call("Blobs.Echo", &Blob{}, &Blob{}))
+	client.Close()
+
+	client = dialClient(t, addr, WithSerializer(serializer.MsgPack))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "big", string(make([]byte, 2<<10)))
+	assert.Error(t, client.CallContext(ctx, "Blobs.Echo", &Blob{}, &Blob{}))
+	client.Close()
+
+	client = dialClient(t, addr, WithSerializer(serializer.MsgPack), WithMaxBodySize(1<<10))
+	defer client.Close()
+	err = client.Call("Blobs.Echo", &Blob{Data: make([]byte, 2<<10)}, &Blob{})
+	assert.ErrorIs(t, err, codec.BodyTooLargeError)
+	assert.Error(t, client.Call("Blobs.Echo", &Blob{}, &Blob{}))
+}
@@ -0,0 +1,33 @@
+package codec
+
+import (
+	"github.com/braver-braver/tinyrpc/checksum"
+	"sync/atomic"
+)
+
+var checksumMismatches atomic.Uint64
+
+// ChecksumMismatches returns how many bodies failed their checksum since the
+// process started, export it to your metrics to spot corrupting links.
+func ChecksumMismatches() uint64 {
+	return checksumMismatches.Load()
+}
+
+// verifyChecksum checks body against the checksum of its header. Bodies
+// without a checksum pass unless the options require one.
+func (o *options) verifyChecksum(t checksum.Type, sum uint64, body []byte) error {
+	if t == checksum.None {
+		if o.requireChecksum {
+			return ChecksumRequiredError
+		}
+		return nil
+	}
+	if !t.Valid() {
+		return NotFoundChecksumError
+	}
+	if t.Sum(body) != sum {
+		checksumMismatches.Add(1)
+		return UnexpectedChecksumError
+	}
+	return nil
+}
@@ -4,53 +4,86 @@ import (
 	"bufio"
 	"github.com/braver-braver/tinyrpc/compressor"
 	"github.com/braver-braver/tinyrpc/header"
+	"github.com/braver-braver/tinyrpc/internal/bufpool"
 	"github.com/braver-braver/tinyrpc/serializer"
-	"hash/crc32"
 	"io"
-	"net/rpc"
 	"sync"
 )
 
 type clientCodec struct {
-	r io.Reader
-	w io.Writer
+	r *bufio.Reader
+	w *bufio.Writer
 	c io.Closer
 
 	compressor     compressor.CompressType
-	serializer     serializer.Serializer
+	serializer     serializer.SerializeType
+	options        options
 	responseHeader header.ResponseHeader
+	headerBuf      []byte     // the last header read, reused for the next one
+	bodyBuf        []byte     // the last body decompressed, reused for the next one
 	mutex          sync.Mutex // protect pending map
 	pending        map[uint64]string
 }
 
-func NewClientCodec(conn io.ReadWriteCloser, compressType compressor.CompressType, serializer serializer.Serializer) rpc.ClientCodec {
-	return &clientCodec{
+// NewClientCodec creates a ClientCodec on conn that sends its requests with
+// the given compressor and serializer.
+func NewClientCodec(conn io.ReadWriteCloser, compressType compressor.CompressType, serializeType serializer.SerializeType, opts ...Option) ClientCodec {
+	c := &clientCodec{
 		r:          bufio.NewReader(conn),
 		w:          bufio.NewWriter(conn),
 		c:          conn,
 		compressor: compressType,
-		serializer: serializer,
+		serializer: serializeType,
 		pending:    make(map[uint64]string),
 	}
+	for _, opt := range opts {
+		opt(&c.options)
+	}
+	return c
 }
 
 // WriteRequest writes a rpc requestHeader & its body  to io stream.
-func (c *clientCodec) WriteRequest(r *rpc.Request, params interface{}) error {
-	c.mutex.Lock()
-	c.pending[r.Seq] = r.ServiceMethod
-	c.mutex.Unlock()
+func (c *clientCodec) WriteRequest(r *Request, params interface{}) error {
+	switch r.Type {
+	case header.FrameUnary:
+		c.mutex.Lock()
+		c.pending[r.Seq] = r.ServiceMethod
+		c.mutex.Unlock()
+	case header.FrameCancel:
+		// a late response is read as one to an unknown call
+		c.mutex.Lock()
+		delete(c.pending, r.Seq)
+		c.mutex.Unlock()
+	}
 
 	if _, ok := compressor.Compressors[c.compressor]; !ok {
 		return NotFoundCompressorError
 	}
-	body, err := c.serializer.Marshal(params)
+	if !c.options.checksumType.Valid() {
+		return NotFoundChecksumError
+	}
+	serializer, ok := serializer.Lookup(c.serializer)
+	if !ok {
+		return NotFoundSerializerError
+	}
+	body, buf, err := marshalBody(serializer, params)
 	if err != nil {
 		return err
 	}
-	compressedBody, err := compressor.Compressors[c.compressor].Compress(body)
+	if buf != nil {
+		defer bufpool.Put(buf)
+	}
+	compressType := c.compressor
+	if len(body) < c.options.minCompressLen {
+		compressType = compressor.Raw
+	}
+	compressedBody, buf, err := compressBody(compressor.Compressors[compressType], body)
 	if err != nil {
 		return err
 	}
+	if buf != nil {
+		defer bufpool.Put(buf)
+	}
 
 	h := header.RequestPool.Get().(*header.RequestHeader)
 	defer func() {
@@ -60,72 +93,79 @@ func (c *clientCodec) WriteRequest(r *rpc.Request, params interface{}) error {
 	h.ID = r.Seq
 	h.Method = r.ServiceMethod
 	h.RequestLen = uint32(len(compressedBody))
-	h.CompressType = c.compressor
-	h.Checksum = crc32.ChecksumIEEE(compressedBody)
+	h.CompressType = compressType
+	h.SerializeType = c.serializer
+	h.ChecksumType = c.options.checksumType
+	h.Checksum = c.options.checksumType.Sum(compressedBody)
+	h.Timeout = r.Timeout
+	h.Metadata = r.Metadata
+	h.FrameType = r.Type
+	h.Window = r.Window
 
-	if err = sendFrame(c.w, h.Marshall()); err != nil {
-		return err
-	}
-	// requestHeader 的 存在，已经标定了 请求体的长度，调用write 方法直接将 内容写入流即可。
-	if err = write(c.w, compressedBody); err != nil {
-		return err
-	}
-
-	err = c.w.(*bufio.Writer).Flush()
-	if err != nil {
-		return err
-	}
-	return nil
+	// requestHeader 的 存在，已经标定了 请求体的长度，header 之后直接将 内容写入流即可。
+	return sendFrame(c.w, h, compressedBody)
 }
 
 // ReadResponseHeader reads ResponseHeader from offered io stream
-func (c *clientCodec) ReadResponseHeader(r *rpc.Response) error {
+func (c *clientCodec) ReadResponseHeader(r *Response) error {
 	c.responseHeader.ResetHeader()
-	data, err := receiveFrame(c.r)
+	data, err := receiveFrame(c.r, c.options.maxHeaderSize, c.headerBuf)
 	if err != nil {
 		return err
 	}
+	c.headerBuf = data
 	err = c.responseHeader.Unmarshall(data)
 	if err != nil {
 		return err
 	}
 	c.mutex.Lock()
 	r.Seq = c.responseHeader.ID
-	// TODD, _, ok := c.pending[r.Seq] ??
-	r.ServiceMethod = c.pending[r.Seq]
+	r.Type = c.responseHeader.FrameType
+	r.Window = c.responseHeader.Window
+	if r.Type == header.FrameUnary {
+		r.ServiceMethod = c.pending[r.Seq]
+		delete(c.pending, r.Seq)
+	}
 	r.Error = c.responseHeader.Error
-	delete(c.pending, r.Seq)
+	r.Code = c.responseHeader.Code
+	r.Details = c.responseHeader.Details
+	r.Metadata = c.responseHeader.Metadata
 	c.mutex.Unlock()
 	return nil
 }
 
 // ReadResponseBody reads rpc response body from offered io stream
 func (c *clientCodec) ReadResponseBody(param any) error {
+	if err := c.options.checkBodySize(c.responseHeader.ResponseLen); err != nil {
+		return err
+	}
 	if param == nil {
-		if c.responseHeader.ResponseLen != 0 {
-			if err := read(c.r, make([]byte, c.responseHeader.ResponseLen)); err != nil {
-				return err
-			}
-		}
-		return nil
+		return discard(c.r, c.responseHeader.ResponseLen)
 	}
 
-	responseBody := make([]byte, c.responseHeader.ResponseLen)
-	err := read(c.r, responseBody)
+	buf, err := readBody(c.r, c.responseHeader.ResponseLen)
 	if err != nil {
 		return err
 	}
-	if c.responseHeader.GetCompressType() != c.compressor {
+	defer bufpool.Put(buf)
+	responseBody := *buf
+	// the server answers with the negotiated compressor, or Raw for bodies
+	// below its minimum compress length.
+	if ct := c.responseHeader.GetCompressType(); ct != c.compressor && ct != compressor.Raw {
 		return CompressorTypeMismatchError
 	}
-	if c.responseHeader.Checksum != 0 && crc32.ChecksumIEEE(responseBody) != c.responseHeader.Checksum {
-		return UnexpectedChecksumError
+	if err = c.options.verifyChecksum(c.responseHeader.ChecksumType, c.responseHeader.Checksum, responseBody); err != nil {
+		return err
+	}
+	serializer, ok := serializer.Lookup(c.responseHeader.SerializeType)
+	if !ok {
+		return NotFoundSerializerError
 	}
-	resp, err := compressor.Compressors[c.responseHeader.CompressType].Decompress(responseBody)
+	resp, err := decompressBody(compressor.Compressors[c.responseHeader.CompressType], &c.bodyBuf, responseBody, c.options.maxMessageSize)
 	if err != nil {
 		return err
 	}
-	return c.serializer.UnMarshal(resp, param)
+	return decodeBody(serializer, resp, param)
 }
 
 func (c *clientCodec) Close() error {
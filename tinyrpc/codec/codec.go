@@ -0,0 +1,91 @@
+package codec
+
+import (
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/header"
+	"github.com/braver-braver/tinyrpc/serializer"
+	"time"
+)
+
+// Request is the decoded header of a rpc request.
+type Request struct {
+	ServiceMethod string // format: "Service.Method"
+	// Seq is the sequence number chosen by client. For stream frames it is
+	// the ID of the stream, as chosen by the client, on both sides.
+	Seq uint64
+	// Type is the type of the frame, Window the credits it grants.
+	Type   header.FrameType
+	Window uint32
+	// Timeout is the time left until the client's deadline, zero means the
+	// call has no deadline.
+	Timeout time.Duration
+	// Metadata is sent along with the request.
+	Metadata map[string]string
+}
+
+// Response is the decoded header of a rpc response.
+type Response struct {
+	ServiceMethod string // echoes that of the Request
+	Seq           uint64 // echoes that of the Request
+	Type          header.FrameType
+	Window        uint32
+	Error         string // error, if any
+	// Code classifies Error, it is OK for peers that don't send codes.
+	Code codes.Code
+	// Details describe Error further, each is a marshalled
+	// google.protobuf.Any.
+	Details [][]byte
+	// Metadata is the trailer sent along with the response.
+	Metadata map[string]string
+}
+
+// ServerCodec implements reading of rpc requests and writing of rpc
+// responses for the server side of a rpc session. The server calls
+// ReadRequestHeader and ReadRequestBody in pairs to read requests from the
+// connection, and it calls WriteResponse to write a response back.
+type ServerCodec interface {
+	ReadRequestHeader(*Request) error
+	ReadRequestBody(any) error
+	WriteResponse(*Response, any) error
+	Close() error
+}
+
+// ClientCodec implements writing of rpc requests and reading of rpc
+// responses for the client side of a rpc session. The client calls
+// WriteRequest to write a request to the connection and calls
+// ReadResponseHeader and ReadResponseBody in pairs to read responses.
+type ClientCodec interface {
+	WriteRequest(*Request, any) error
+	ReadResponseHeader(*Response) error
+	ReadResponseBody(any) error
+	Close() error
+}
+
+// Message is a body kept undecoded, for the messages of streams that are
+// decoded once the application asks for them. Pass a *Message to
+// ReadRequestBody or ReadResponseBody to fill it.
+type Message struct {
+	data       []byte
+	serializer serializer.Serializer
+}
+
+// Decode decodes the message into v.
+func (m *Message) Decode(v any) error {
+	return m.serializer.UnMarshal(m.data, v)
+}
+
+// Len returns the size of the encoded message.
+func (m *Message) Len() int {
+	return len(m.data)
+}
+
+// decodeBody decodes data into param, or keeps a copy of it if param is a
+// *Message, as data is part of a buffer that gets reused.
+func decodeBody(s serializer.Serializer, data []byte, param any) error {
+	if m, ok := param.(*Message); ok {
+		m.data = append([]byte(nil), data...)
+		m.serializer = s
+		return nil
+	}
+	return s.UnMarshal(data, param)
+}
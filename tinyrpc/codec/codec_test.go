@@ -0,0 +1,348 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/braver-braver/tinyrpc/checksum"
+	"github.com/braver-braver/tinyrpc/compressor"
+	"github.com/braver-braver/tinyrpc/header"
+	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/braver-braver/tinyrpc/serializer"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestClientCodec_MinCompressLen(t *testing.T) {
+	cases := []struct {
+		name   string
+		arg    *message.ArithRequest
+		expect compressor.CompressType
+	}{
+		{"below threshold", &message.ArithRequest{A: 1}, compressor.Raw},
+		{"empty body", &message.ArithRequest{}, compressor.Raw},
+		{"above threshold", &message.ArithRequest{A: 1, B: 2}, compressor.Gzip},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			cc := NewClientCodec(client, compressor.Gzip, serializer.Proto, WithMinCompressLen(10))
+			sc := NewServerCodec(server)
+			defer cc.Close()
+			defer sc.Close()
+
+			go func() {
+				_ = cc.WriteRequest(&Request{ServiceMethod: "Arith.Add", Seq: 1}, c.arg)
+			}()
+			req := &Request{}
+			assert.NoError(t, sc.ReadRequestHeader(req))
+			assert.Equal(t, c.expect, sc.(*serverCodec).requestHeader.CompressType)
+			arg := &message.ArithRequest{}
+			assert.NoError(t, sc.ReadRequestBody(arg))
+			assert.Equal(t, c.arg.A, arg.A)
+			assert.Equal(t, c.arg.B, arg.B)
+
+			// the reply is compressed like the request and the client accepts it
+			go func() {
+				_ = sc.WriteResponse(&Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq},
+					&message.ArithResponse{C: 3})
+			}()
+			resp := &Response{}
+			assert.NoError(t, cc.ReadResponseHeader(resp))
+			assert.Equal(t, "Arith.Add", resp.ServiceMethod)
+			reply := &message.ArithResponse{}
+			assert.NoError(t, cc.ReadResponseBody(reply))
+			assert.Equal(t, float64(3), reply.C)
+		})
+	}
+}
+
+func TestReceiveFrame_MaxSize(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    []byte
+		maxSize int
+		expect  error
+	}{
+		{"within limit", []byte{0x2, 0xa, 0xb}, 2, nil},
+		{"no limit", []byte{0x2, 0xa, 0xb}, 0, nil},
+		{"too large", []byte{0x3, 0xa, 0xb, 0xc}, 2, HeaderTooLargeError},
+		// the size alone must not make us allocate
+		{"huge size", []byte{0xff, 0xff, 0xff, 0xff, 0xf}, 1 << 10, HeaderTooLargeError},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := receiveFrame(bufio.NewReader(bytes.NewReader(c.data)), c.maxSize, nil)
+			assert.ErrorIs(t, err, c.expect)
+		})
+	}
+}
+
+// loopback connects a client codec to a server codec in memory.
+type loopback struct {
+	r *bytes.Buffer
+	w *bytes.Buffer
+}
+
+func (l loopback) Read(p []byte) (int, error)  { return l.r.Read(p) }
+func (l loopback) Write(p []byte) (int, error) { return l.w.Write(p) }
+func (l loopback) Close() error                { return nil }
+
+// BenchmarkCodec_RoundTrip measures a whole call through both codecs: write
+// the request, read it, write the response and read it. The frames and bodies
+// live in pooled buffers. What is left allocates on purpose: the method name,
+// the metadata map and its strings of the request header, 5 allocations, are
+// handed to the call and outlive the frame. Snappy adds 2 allocations per
+// compressed body inside the s2 writer.
+func BenchmarkCodec_RoundTrip(b *testing.B) {
+	for _, ct := range []compressor.CompressType{compressor.Raw, compressor.Snappy} {
+		b.Run(fmt.Sprintf("compressor-%d", ct), func(b *testing.B) {
+			toServer, toClient := &bytes.Buffer{}, &bytes.Buffer{}
+			cc := NewClientCodec(loopback{toClient, toServer}, ct, serializer.Proto)
+			sc := NewServerCodec(loopback{toServer, toClient})
+			ctx := map[string]string{"trace-id": "0af7651916cd43dd8448eb211c80319c"}
+			args, reply := &message.ArithRequest{A: 1, B: 2}, &message.ArithResponse{C: 3}
+			var req Request
+			var resp Response
+			call := &Request{ServiceMethod: "Arith.Add", Metadata: ctx}
+			answer := &Response{}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				call.Seq = uint64(i)
+				if err := cc.WriteRequest(call, args); err != nil {
+					b.Fatal(err)
+				}
+				if err := sc.ReadRequestHeader(&req); err != nil {
+					b.Fatal(err)
+				}
+				if err := sc.ReadRequestBody(args); err != nil {
+					b.Fatal(err)
+				}
+				*answer = Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq}
+				if err := sc.WriteResponse(answer, reply); err != nil {
+					b.Fatal(err)
+				}
+				if err := cc.ReadResponseHeader(&resp); err != nil {
+					b.Fatal(err)
+				}
+				if err := cc.ReadResponseBody(reply); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestCodec_Checksum(t *testing.T) {
+	cases := []struct {
+		name     string
+		checksum checksum.Type
+		required bool
+		corrupt  bool
+		expect   error
+	}{
+		{"ieee", checksum.IEEE, true, false, nil},
+		{"crc32c", checksum.CRC32C, true, false, nil},
+		{"xxhash64", checksum.XXHash64, true, false, nil},
+		{"none", checksum.None, false, false, nil},
+		{"none but required", checksum.None, true, false, ChecksumRequiredError},
+		{"corrupted", checksum.CRC32C, false, true, UnexpectedChecksumError},
+		{"corrupted xxhash64", checksum.XXHash64, false, true, UnexpectedChecksumError},
+		{"corrupted without checksum", checksum.None, false, true, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			toServer, toClient := &bytes.Buffer{}, &bytes.Buffer{}
+			cc := NewClientCodec(loopback{toClient, toServer}, compressor.Raw, serializer.Proto, WithChecksum(c.checksum))
+			sc := NewServerCodec(loopback{toServer, toClient}, WithChecksumRequired(c.required))
+			assert.NoError(t, cc.WriteRequest(&Request{ServiceMethod: "Arith.Add"}, &message.ArithRequest{A: 1, B: 2}))
+			if c.corrupt {
+				// flip a bit of B, the last field of the body
+				toServer.Bytes()[toServer.Len()-1] ^= 0x1
+			}
+
+			mismatches := ChecksumMismatches()
+			req := &Request{}
+			assert.NoError(t, sc.ReadRequestHeader(req))
+			assert.ErrorIs(t, sc.ReadRequestBody(&message.ArithRequest{}), c.expect)
+			if c.expect == UnexpectedChecksumError {
+				assert.Equal(t, mismatches+1, ChecksumMismatches())
+			}
+			if c.expect != nil {
+				return
+			}
+
+			// the response uses the checksum of the request
+			assert.NoError(t, sc.WriteResponse(&Response{Seq: req.Seq}, &message.ArithResponse{C: 3}))
+			resp, reply := &Response{}, &message.ArithResponse{}
+			assert.NoError(t, cc.ReadResponseHeader(resp))
+			assert.Equal(t, c.checksum, cc.(*clientCodec).responseHeader.ChecksumType)
+			assert.NoError(t, cc.ReadResponseBody(reply))
+			assert.Equal(t, float64(3), reply.C)
+		})
+	}
+
+	cc := NewClientCodec(loopback{&bytes.Buffer{}, &bytes.Buffer{}}, compressor.Raw, serializer.Proto, WithChecksum(0xff))
+	assert.ErrorIs(t, cc.WriteRequest(&Request{ServiceMethod: "Arith.Add"}, &message.ArithRequest{}), NotFoundChecksumError)
+}
+
+func TestCodec_StreamFrames(t *testing.T) {
+	toServer, toClient := &bytes.Buffer{}, &bytes.Buffer{}
+	cc := NewClientCodec(loopback{toClient, toServer}, compressor.Gzip, serializer.JSON)
+	sc := NewServerCodec(loopback{toServer, toClient})
+
+	assert.NoError(t, cc.WriteRequest(&Request{ServiceMethod: "Feed.Watch", Seq: 7, Type: header.FrameStreamOpen, Window: 16}, nil))
+	assert.NoError(t, cc.WriteRequest(&Request{Seq: 7, Type: header.FrameStreamMessage}, &message.ArithRequest{A: 1}))
+
+	// the server numbers the stream itself, its frames carry that seq.
+	req := &Request{}
+	assert.NoError(t, sc.ReadRequestHeader(req))
+	assert.Equal(t, Request{ServiceMethod: "Feed.Watch", Seq: 1, Type: header.FrameStreamOpen, Window: 16}, *req)
+	assert.NoError(t, sc.ReadRequestBody(nil))
+	assert.NoError(t, sc.ReadRequestHeader(req))
+	assert.Equal(t, header.FrameStreamMessage, req.Type)
+	assert.Equal(t, uint64(1), req.Seq)
+	m := &Message{}
+	assert.NoError(t, sc.ReadRequestBody(m))
+	args := &message.ArithRequest{}
+	assert.NoError(t, m.Decode(args))
+	assert.Equal(t, float64(1), args.A)
+
+	// the server answers the frames of the stream like the one opening it,
+	// until the stream ends.
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, sc.WriteResponse(&Response{Seq: 1, Type: header.FrameStreamMessage}, &message.ArithResponse{C: float64(i)}))
+	}
+	assert.NoError(t, sc.WriteResponse(&Response{Seq: 1, Type: header.FrameStreamEnd}, nil))
+	assert.ErrorIs(t, sc.WriteResponse(&Response{Seq: 1, Type: header.FrameStreamMessage}, nil), InvalidSequenceError)
+
+	for i := 0; i < 2; i++ {
+		resp := &Response{}
+		assert.NoError(t, cc.ReadResponseHeader(resp))
+		assert.Equal(t, header.FrameStreamMessage, resp.Type)
+		m := &Message{}
+		assert.NoError(t, cc.ReadResponseBody(m))
+		reply := &message.ArithResponse{}
+		assert.NoError(t, m.Decode(reply))
+		assert.Equal(t, float64(i), reply.C)
+	}
+	resp := &Response{}
+	assert.NoError(t, cc.ReadResponseHeader(resp))
+	assert.Equal(t, Response{Seq: 7, Type: header.FrameStreamEnd}, *resp)
+	assert.NoError(t, cc.ReadResponseBody(nil))
+}
+
+func TestCodec_OneWay(t *testing.T) {
+	toServer, toClient := &bytes.Buffer{}, &bytes.Buffer{}
+	cc := NewClientCodec(loopback{toClient, toServer}, compressor.Raw, serializer.Proto)
+	sc := NewServerCodec(loopback{toServer, toClient})
+
+	assert.NoError(t, cc.WriteRequest(&Request{ServiceMethod: "Audit.Log", Seq: 3, Type: header.FrameOneWay}, &message.ArithRequest{A: 1}))
+	req := &Request{}
+	assert.NoError(t, sc.ReadRequestHeader(req))
+	assert.Equal(t, header.FrameOneWay, req.Type)
+	args := &message.ArithRequest{}
+	assert.NoError(t, sc.ReadRequestBody(args))
+	assert.Equal(t, float64(1), args.A)
+
+	assert.NoError(t, sc.WriteResponse(&Response{Seq: req.Seq}, &message.ArithResponse{}))
+	assert.Zero(t, toClient.Len())
+	assert.ErrorIs(t, sc.WriteResponse(&Response{Seq: req.Seq}, nil), InvalidSequenceError)
+}
+
+func TestCodec_Cancel(t *testing.T) {
+	toServer, toClient := &bytes.Buffer{}, &bytes.Buffer{}
+	cc := NewClientCodec(loopback{toClient, toServer}, compressor.Raw, serializer.Proto)
+	sc := NewServerCodec(loopback{toServer, toClient})
+
+	assert.NoError(t, cc.WriteRequest(&Request{ServiceMethod: "Arith.Add", Seq: 5}, &message.ArithRequest{}))
+	assert.NoError(t, cc.WriteRequest(&Request{ServiceMethod: "Feed.Watch", Seq: 6, Type: header.FrameStreamOpen}, nil))
+	assert.NoError(t, cc.WriteRequest(&Request{Seq: 5, Type: header.FrameCancel}, nil))
+	assert.NoError(t, cc.WriteRequest(&Request{Seq: 6, Type: header.FrameCancel}, nil))
+	assert.NoError(t, cc.WriteRequest(&Request{Seq: 9, Type: header.FrameCancel}, nil))
+
+	var seqs []uint64
+	for i := 0; i < 5; i++ {
+		req := &Request{}
+		assert.NoError(t, sc.ReadRequestHeader(req))
+		assert.NoError(t, sc.ReadRequestBody(nil))
+		seqs = append(seqs, req.Seq)
+	}
+	// the cancels name the server's seq of the call and the stream, or 0
+	assert.Equal(t, []uint64{1, 2, 1, 2, 0}, seqs)
+
+	// nothing is written back for them anymore
+	assert.NoError(t, sc.WriteResponse(&Response{Seq: 1}, &message.ArithResponse{}))
+	assert.NoError(t, sc.WriteResponse(&Response{Seq: 2, Type: header.FrameStreamEnd}, nil))
+	assert.Zero(t, toClient.Len())
+}
+
+func TestServerCodec_Hello(t *testing.T) {
+	hello := &Hello{Version: ProtocolVersion, CompressType: compressor.Gzip, SerializeType: serializer.JSON}
+	cases := []struct {
+		name          string
+		compressType  compressor.CompressType
+		serializeType serializer.SerializeType
+		expect        error
+	}{
+		{"negotiated", compressor.Gzip, serializer.JSON, nil},
+		{"raw", compressor.Raw, serializer.JSON, nil},
+		{"other compressor", compressor.Snappy, serializer.JSON, CompressorTypeMismatchError},
+		{"other serializer", compressor.Gzip, serializer.Proto, SerializerTypeMismatchError},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			toServer := &bytes.Buffer{}
+			cc := NewClientCodec(loopback{&bytes.Buffer{}, toServer}, c.compressType, c.serializeType)
+			sc := NewServerCodec(loopback{toServer, &bytes.Buffer{}}, WithHello(hello))
+
+			assert.NoError(t, cc.WriteRequest(&Request{ServiceMethod: "Arith.Add", Seq: 1}, &message.ArithRequest{A: 1}))
+			assert.NoError(t, cc.WriteRequest(&Request{ServiceMethod: "Arith.Add", Seq: 2}, &message.ArithRequest{A: 2}))
+			for _, a := range []float64{1, 2} {
+				assert.NoError(t, sc.ReadRequestHeader(&Request{}))
+				args := &message.ArithRequest{}
+				err := sc.ReadRequestBody(args)
+				assert.Equal(t, c.expect, err)
+				if err == nil {
+					assert.Equal(t, a, args.A)
+				}
+			}
+		})
+	}
+}
+
+func TestServerCodec_ResponseCompressor(t *testing.T) {
+	hello := &Hello{Version: ProtocolVersion, CompressType: compressor.Gzip}
+	cases := []struct {
+		name   string
+		reply  *message.ArithResponse
+		expect compressor.CompressType
+	}{
+		{"below threshold", &message.ArithResponse{}, compressor.Raw},
+		{"above threshold", &message.ArithResponse{C: 3}, compressor.Gzip},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			toServer, toClient := &bytes.Buffer{}, &bytes.Buffer{}
+			cc := NewClientCodec(loopback{toClient, toServer}, compressor.Gzip, serializer.Proto, WithMinCompressLen(5))
+			sc := NewServerCodec(loopback{toServer, toClient}, WithHello(hello), WithMinCompressLen(5))
+
+			// the request is small enough to be sent Raw
+			assert.NoError(t, cc.WriteRequest(&Request{ServiceMethod: "Arith.Add", Seq: 1}, &message.ArithRequest{}))
+			req := &Request{}
+			assert.NoError(t, sc.ReadRequestHeader(req))
+			assert.Equal(t, compressor.Raw, sc.(*serverCodec).requestHeader.CompressType)
+			assert.NoError(t, sc.ReadRequestBody(&message.ArithRequest{}))
+
+			// the reply is compressed with the negotiated compressor, unless it is small
+			assert.NoError(t, sc.WriteResponse(&Response{Seq: req.Seq}, c.reply))
+			assert.NoError(t, cc.ReadResponseHeader(&Response{}))
+			assert.Equal(t, c.expect, cc.(*clientCodec).responseHeader.CompressType)
+			reply := &message.ArithResponse{}
+			assert.NoError(t, cc.ReadResponseBody(reply))
+			assert.Equal(t, c.reply.C, reply.C)
+		})
+	}
+}
@@ -5,6 +5,12 @@ import "errors"
 var (
 	InvalidSequenceError        = errors.New("invalid sequence number in response")
 	UnexpectedChecksumError     = errors.New("unexpected checksum")
+	NotFoundChecksumError       = errors.New("not found checksum type")
+	ChecksumRequiredError       = errors.New("body has no checksum but one is required")
 	NotFoundCompressorError     = errors.New("not found compressor")
+	NotFoundSerializerError     = errors.New("not found serializer")
 	CompressorTypeMismatchError = errors.New("request and response Compressor type mismatch")
+	SerializerTypeMismatchError = errors.New("serializer type differs from the handshake")
+	HeaderTooLargeError         = errors.New("header too large")
+	BodyTooLargeError           = errors.New("body too large")
 )
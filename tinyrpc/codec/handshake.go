@@ -0,0 +1,244 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/braver-braver/tinyrpc/compressor"
+	"github.com/braver-braver/tinyrpc/serializer"
+	"io"
+	"sort"
+)
+
+// ProtocolVersion is the version of the frame layout spoken by this package.
+const ProtocolVersion = 1
+
+// maxHelloSize bounds the hello a peer may send before it is trusted.
+const maxHelloSize = 4096
+
+// Magic opens every tinyrpc connection, so that non-tinyrpc traffic is
+// rejected instead of being misparsed.
+var Magic = [4]byte{'T', 'R', 'P', 'C'}
+
+var (
+	InvalidMagicError      = errors.New("invalid magic, the peer does not speak tinyrpc")
+	InvalidHelloError      = errors.New("invalid handshake hello")
+	HandshakeRejectedError = errors.New("handshake rejected")
+)
+
+// Hello is the preamble both peers send when a connection starts. The client
+// proposes the compressor and serializer it is going to use, the server
+// answers with the same parameters if it accepts them, or with Error set.
+//
+// A hello looks like:
+// +---------+---------+---------+-------------+-------------+--------------+---------------+----------------+
+// |  Magic  | Version |   Len   | Compressors | Serializers | CompressType | SerializeType |      Error     |
+// +---------+---------+---------+-------------+-------------+--------------+---------------+----------------+
+// | 4 bytes |  uint8  | uvarint | uvarint+u16 | uvarint+u16 |    uint16    |     uint16    | uvarint+string |
+// +---------+---------+---------+-------------+-------------+--------------+---------------+----------------+
+// Compressors and Serializers list the types supported by the sender.
+type Hello struct {
+	Version       uint8
+	Compressors   []compressor.CompressType
+	Serializers   []serializer.SerializeType
+	CompressType  compressor.CompressType
+	SerializeType serializer.SerializeType
+	Error         string
+}
+
+// ClientHandshake sends the client hello on conn and waits for the server to
+// accept it. It returns the server's hello.
+func ClientHandshake(conn io.ReadWriter, compressType compressor.CompressType, serializeType serializer.SerializeType) (*Hello, error) {
+	hello := &Hello{
+		Version:       ProtocolVersion,
+		Compressors:   supportedCompressors(),
+		Serializers:   serializer.Types(),
+		CompressType:  compressType,
+		SerializeType: serializeType,
+	}
+	if !containsCompressType(hello.Compressors, compressType) {
+		return nil, NotFoundCompressorError
+	}
+	if !containsSerializeType(hello.Serializers, serializeType) {
+		return nil, NotFoundSerializerError
+	}
+	if err := writeHello(conn, hello); err != nil {
+		return nil, err
+	}
+	reply, err := readHello(conn)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("%w: %s", HandshakeRejectedError, reply.Error)
+	}
+	if reply.Version != ProtocolVersion ||
+		reply.CompressType != compressType || reply.SerializeType != serializeType {
+		return nil, fmt.Errorf("%w: server answered with version %d, compressor %d, serializer %d",
+			HandshakeRejectedError, reply.Version, reply.CompressType, reply.SerializeType)
+	}
+	return reply, nil
+}
+
+// ServerHandshake reads the client hello from conn and accepts it if the
+// server supports the proposed parameters, otherwise it tells the client why
+// and fails. It returns the client's hello.
+func ServerHandshake(conn io.ReadWriter) (*Hello, error) {
+	hello, err := readHello(conn)
+	if err != nil {
+		return nil, err
+	}
+	reply := &Hello{
+		Version:       ProtocolVersion,
+		Compressors:   supportedCompressors(),
+		Serializers:   serializer.Types(),
+		CompressType:  hello.CompressType,
+		SerializeType: hello.SerializeType,
+	}
+	switch {
+	case hello.Version != ProtocolVersion:
+		reply.Error = fmt.Sprintf("unsupported protocol version %d, server speaks %d", hello.Version, ProtocolVersion)
+	case !containsCompressType(reply.Compressors, hello.CompressType):
+		reply.Error = fmt.Sprintf("unsupported compressor %d", hello.CompressType)
+	case !containsSerializeType(reply.Serializers, hello.SerializeType):
+		reply.Error = fmt.Sprintf("unsupported serializer %d", hello.SerializeType)
+	}
+	if err = writeHello(conn, reply); err != nil {
+		return nil, err
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("%w: %s", HandshakeRejectedError, reply.Error)
+	}
+	return hello, nil
+}
+
+func writeHello(w io.Writer, h *Hello) error {
+	body := binary.AppendUvarint(nil, uint64(len(h.Compressors)))
+	for _, t := range h.Compressors {
+		body = binary.LittleEndian.AppendUint16(body, uint16(t))
+	}
+	body = binary.AppendUvarint(body, uint64(len(h.Serializers)))
+	for _, t := range h.Serializers {
+		body = binary.LittleEndian.AppendUint16(body, uint16(t))
+	}
+	body = binary.LittleEndian.AppendUint16(body, uint16(h.CompressType))
+	body = binary.LittleEndian.AppendUint16(body, uint16(h.SerializeType))
+	body = binary.AppendUvarint(body, uint64(len(h.Error)))
+	body = append(body, h.Error...)
+
+	data := make([]byte, 0, len(Magic)+1+binary.MaxVarintLen64+len(body))
+	data = append(data, Magic[:]...)
+	data = append(data, h.Version)
+	data = binary.AppendUvarint(data, uint64(len(body)))
+	return write(w, append(data, body...))
+}
+
+func readHello(r io.Reader) (*Hello, error) {
+	// the connection is not buffered yet, so read exactly what belongs to
+	// the hello and leave the rest to the codec.
+	var prefix [len(Magic) + 1]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if [4]byte(prefix[:4]) != Magic {
+		return nil, InvalidMagicError
+	}
+	size, err := binary.ReadUvarint(byteReader{r})
+	if err != nil {
+		return nil, err
+	}
+	if size > maxHelloSize {
+		return nil, InvalidHelloError
+	}
+	body := make([]byte, size)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	h := &Hello{Version: prefix[4]}
+	d := helloDecoder{data: body}
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		h.Compressors = append(h.Compressors, compressor.CompressType(d.uint16()))
+	}
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		h.Serializers = append(h.Serializers, serializer.SerializeType(d.uint16()))
+	}
+	h.CompressType = compressor.CompressType(d.uint16())
+	h.SerializeType = serializer.SerializeType(d.uint16())
+	h.Error = string(d.bytes(d.uvarint()))
+	if d.err != nil {
+		return nil, d.err
+	}
+	return h, nil
+}
+
+// helloDecoder reads the hello body, the first error sticks.
+type helloDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *helloDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = InvalidHelloError
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *helloDecoder) uint16() uint16 {
+	b := d.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (d *helloDecoder) bytes(n uint64) []byte {
+	if d.err != nil || n > uint64(len(d.data)) {
+		d.err = InvalidHelloError
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+type byteReader struct {
+	io.Reader
+}
+
+func (b byteReader) ReadByte() (byte, error) {
+	var buf [1]byte
+	_, err := io.ReadFull(b.Reader, buf[:])
+	return buf[0], err
+}
+
+func supportedCompressors() []compressor.CompressType {
+	types := make([]compressor.CompressType, 0, len(compressor.Compressors))
+	for t := range compressor.Compressors {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+func containsCompressType(types []compressor.CompressType, t compressor.CompressType) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSerializeType(types []serializer.SerializeType, t serializer.SerializeType) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
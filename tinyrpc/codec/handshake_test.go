@@ -0,0 +1,134 @@
+package codec
+
+import (
+	"bytes"
+	"github.com/braver-braver/tinyrpc/compressor"
+	"github.com/braver-braver/tinyrpc/serializer"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestHello_RoundTrip(t *testing.T) {
+	hello := &Hello{
+		Version:       ProtocolVersion,
+		Compressors:   []compressor.CompressType{compressor.Raw, compressor.Gzip},
+		Serializers:   []serializer.SerializeType{serializer.Proto},
+		CompressType:  compressor.Gzip,
+		SerializeType: serializer.Proto,
+		Error:         "error",
+	}
+	buf := bytes.NewBuffer(nil)
+	assert.NoError(t, writeHello(buf, hello))
+	assert.Equal(t, []byte{'T', 'R', 'P', 'C', 0x1, 0x12,
+		0x2, 0x0, 0x0, 0x1, 0x0, 0x1, 0x0, 0x0, 0x1, 0x0, 0x0, 0x0,
+		0x5, 0x65, 0x72, 0x72, 0x6f, 0x72}, buf.Bytes())
+
+	got, err := readHello(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, hello, got)
+}
+
+func TestReadHello(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"not tinyrpc", []byte("GET / HTTP/1.1\r\n"), InvalidMagicError},
+		{"too large", []byte{'T', 'R', 'P', 'C', 0x1, 0xff, 0xff, 0x3}, InvalidHelloError},
+		{"truncated body", []byte{'T', 'R', 'P', 'C', 0x1, 0x2, 0x5, 0x0}, InvalidHelloError},
+		{"truncated stream", []byte{'T', 'R', 'P'}, io.ErrUnexpectedEOF},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := readHello(bytes.NewReader(c.data))
+			assert.ErrorIs(t, err, c.err)
+		})
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	type expect struct {
+		client error
+		server error
+	}
+	cases := []struct {
+		name          string
+		hello         *Hello
+		compressType  compressor.CompressType
+		serializeType serializer.SerializeType
+		expect        expect
+	}{
+		{
+			"accepted",
+			nil,
+			compressor.Snappy,
+			serializer.Proto,
+			expect{nil, nil},
+		},
+		{
+			"unsupported version",
+			&Hello{Version: ProtocolVersion + 1},
+			0,
+			0,
+			expect{HandshakeRejectedError, HandshakeRejectedError},
+		},
+		{
+			"unsupported compressor",
+			&Hello{Version: ProtocolVersion, CompressType: 0xff},
+			0,
+			0,
+			expect{HandshakeRejectedError, HandshakeRejectedError},
+		},
+		{
+			"unsupported serializer",
+			&Hello{Version: ProtocolVersion, SerializeType: 0xff},
+			0,
+			0,
+			expect{HandshakeRejectedError, HandshakeRejectedError},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			serverErr := make(chan error, 1)
+			go func() {
+				_, err := ServerHandshake(server)
+				serverErr <- err
+			}()
+
+			var err error
+			if c.hello == nil {
+				var reply *Hello
+				reply, err = ClientHandshake(client, c.compressType, c.serializeType)
+				if err == nil {
+					assert.Equal(t, c.compressType, reply.CompressType)
+					assert.Equal(t, c.serializeType, reply.SerializeType)
+				}
+			} else {
+				// hand-craft hellos the client would refuse to send
+				assert.NoError(t, writeHello(client, c.hello))
+				var reply *Hello
+				reply, err = readHello(client)
+				assert.NoError(t, err)
+				if reply.Error != "" {
+					err = HandshakeRejectedError
+				}
+			}
+			assert.ErrorIs(t, err, c.expect.client)
+			assert.ErrorIs(t, <-serverErr, c.expect.server)
+		})
+	}
+}
+
+func TestClientHandshake_UnknownParameters(t *testing.T) {
+	_, err := ClientHandshake(bytes.NewBuffer(nil), 0xff, serializer.Proto)
+	assert.ErrorIs(t, err, NotFoundCompressorError)
+	_, err = ClientHandshake(bytes.NewBuffer(nil), compressor.Raw, 0xff)
+	assert.ErrorIs(t, err, NotFoundSerializerError)
+}
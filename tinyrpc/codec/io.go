@@ -1,48 +1,152 @@
 package codec
 
 import (
+	"bufio"
 	"encoding/binary"
+	"fmt"
+	"github.com/braver-braver/tinyrpc/compressor"
+	"github.com/braver-braver/tinyrpc/internal/bufpool"
+	"github.com/braver-braver/tinyrpc/serializer"
 	"io"
 	"net"
 )
 
-// sendFrame 函数将会向IO 写入 uvarint类型的size，表示要发送数据的长度，随后将该字节slice 类型数据 data 写入 IO 流中。
-func sendFrame(w io.Writer, data []byte) (err error) {
+// frameBufferSize is the pooled buffer a header frame is encoded into, large
+// enough for a header with some metadata.
+const frameBufferSize = 512
+
+// maxScratchSize is the largest decompressed body a codec keeps its buffer
+// for, so that a connection doesn't pin the memory of its largest call.
+const maxScratchSize = 1 << 20
+
+// headerMarshaller is implemented by the request and response headers.
+type headerMarshaller interface {
+	MarshallAppend(dst []byte) []byte
+}
+
+// sendFrame 函数将会向IO 写入 uvarint类型的size，表示要发送数据的长度，随后将 header 与 body 写入 IO 流中。
+// The header is encoded into a pooled buffer behind room for its length, so
+// that the frame is written without allocating.
+func sendFrame(w *bufio.Writer, h headerMarshaller, body []byte) error {
+	buf := bufpool.Get(frameBufferSize)
+	defer bufpool.Put(buf)
+	frame := h.MarshallAppend((*buf)[:binary.MaxVarintLen64])
+	*buf = frame
+
 	var size [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(size[:], uint64(len(frame)-binary.MaxVarintLen64))
+	start := binary.MaxVarintLen64 - n
+	copy(frame[start:], size[:n])
 
-	if len(data) == 0 {
-		n := binary.PutUvarint(size[:], uint64(0))
-		if err = write(w, size[:n]); err != nil {
-			return
-		}
-		return
+	if _, err := w.Write(frame[start:]); err != nil {
+		return err
 	}
-
-	n := binary.PutUvarint(size[:], uint64(len(data)))
-	if err = write(w, size[:n]); err != nil {
+	if _, err := w.Write(body); err != nil {
 		return err
 	}
+	return w.Flush()
+}
 
-	if err = write(w, data); err != nil {
-		return err
+// receiveFrame reads a frame written by sendFrame into buf, which is grown if
+// it is too small. Frames longer than maxSize bytes are refused before
+// anything is allocated for them, a maxSize <= 0 means no limit.
+func receiveFrame(r *bufio.Reader, maxSize int, buf []byte) (data []byte, err error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && size > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: %d bytes, limit is %d", HeaderTooLargeError, size, maxSize)
+	}
+	if uint64(cap(buf)) < size {
+		buf = make([]byte, size)
 	}
-	return
+	data = buf[:size]
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
 
-func receiveFrame(r io.Reader) (data []byte, err error) {
-	size, err := binary.ReadUvarint(r.(io.ByteReader))
+// readBody reads a body of size bytes into a pooled buffer, hand it back
+// with bufpool.Put once the body is decoded.
+func readBody(r *bufio.Reader, size uint32) (*[]byte, error) {
+	buf := bufpool.Get(int(size))
+	*buf = (*buf)[:size]
+	if _, err := io.ReadFull(r, *buf); err != nil {
+		bufpool.Put(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// marshalBody encodes message with s, into a pooled buffer if s is a
+// serializer.AppendSerializer. The returned buffer, if not nil, holds the
+// body, hand it back with bufpool.Put once the body is written. A nil
+// message has an empty body.
+func marshalBody(s serializer.Serializer, message any) ([]byte, *[]byte, error) {
+	if message == nil {
+		return nil, nil, nil
+	}
+	as, ok := s.(serializer.AppendSerializer)
+	if !ok {
+		body, err := s.Marshal(message)
+		return body, nil, err
+	}
+	buf := bufpool.Get(as.Size(message))
+	body, err := as.MarshalAppend(*buf, message)
+	if err != nil {
+		bufpool.Put(buf)
+		return nil, nil, err
+	}
+	*buf = body
+	return body, buf, nil
+}
+
+// compressBody compresses body with c, into a pooled buffer if c is a
+// compressor.AppendCompressor. The returned buffer, if not nil, holds the
+// result, hand it back with bufpool.Put once the body is written.
+func compressBody(c compressor.Compressor, body []byte) ([]byte, *[]byte, error) {
+	ac, ok := c.(compressor.AppendCompressor)
+	if !ok {
+		data, err := c.Compress(body)
+		return data, nil, err
+	}
+	buf := bufpool.Get(len(body))
+	data, err := ac.CompressAppend(*buf, body)
+	if err != nil {
+		bufpool.Put(buf)
+		return nil, nil, err
+	}
+	*buf = data
+	return data, buf, nil
+}
+
+// decompressBody decompresses body with c like compressor.Decompress. If c
+// is a compressor.AppendCompressor, the result is written into scratch,
+// which keeps the buffer for the next body; the result is only valid until
+// then.
+func decompressBody(c compressor.Compressor, scratch *[]byte, body []byte, limit int) ([]byte, error) {
+	ac, ok := c.(compressor.AppendCompressor)
+	if !ok {
+		return compressor.Decompress(c, body, limit)
+	}
+	data, err := ac.DecompressAppend((*scratch)[:0], body, limit)
 	if err != nil {
 		return nil, err
 	}
-	if size != 0 {
-		data = make([]byte, size)
-		if err = read(r, data); err != nil {
-			return nil, err
-		}
+	if cap(data) <= maxScratchSize {
+		*scratch = data[:0]
 	}
 	return data, nil
 }
 
+// discard skips a body of size bytes.
+func discard(r *bufio.Reader, size uint32) error {
+	_, err := r.Discard(int(size))
+	return err
+}
+
 // 注意， 实际实现中考虑传入的是 bufio 的 writer（或 reader）
 // 注意，由于 codec 层会传入一个bufio类型的结构体，bufio类型实现了有缓冲的IO操作，
 // 以便减少IO在用户态与内核态拷贝的次数。
@@ -56,16 +160,3 @@ func write(w io.Writer, data []byte) error {
 	}
 	return nil
 }
-
-func read(r io.Reader, data []byte) (err error) {
-	for index := 0; index < len(data); {
-		n, err := r.Read(data[index:])
-		if err != nil {
-			if _, ok := err.(net.Error); !ok {
-				return err
-			}
-		}
-		index += n
-	}
-	return nil
-}
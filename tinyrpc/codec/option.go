@@ -0,0 +1,90 @@
+package codec
+
+import (
+	"fmt"
+	"github.com/braver-braver/tinyrpc/checksum"
+)
+
+// Option configures a client or a server codec.
+type Option func(o *options)
+
+type options struct {
+	minCompressLen int
+	maxMessageSize int
+	maxHeaderSize  int
+	maxBodySize    int
+
+	checksumType    checksum.Type
+	requireChecksum bool
+
+	hello *Hello
+}
+
+// WithMinCompressLen makes the codec send bodies shorter than n bytes Raw, as
+// compressing them would only make them bigger.
+func WithMinCompressLen(n int) Option {
+	return func(o *options) {
+		o.minCompressLen = n
+	}
+}
+
+// WithMaxMessageSize limits the decompressed size of the bodies a codec
+// reads to n bytes, larger ones fail with compressor.MessageTooLargeError.
+// n <= 0 means no limit.
+func WithMaxMessageSize(n int) Option {
+	return func(o *options) {
+		o.maxMessageSize = n
+	}
+}
+
+// WithMaxHeaderSize limits the size of the headers a codec reads to n bytes,
+// larger ones fail with HeaderTooLargeError. n <= 0 means no limit.
+func WithMaxHeaderSize(n int) Option {
+	return func(o *options) {
+		o.maxHeaderSize = n
+	}
+}
+
+// WithMaxBodySize limits the size of the bodies a codec reads, as sent on the
+// wire, to n bytes. Larger ones fail with BodyTooLargeError and are left
+// unread, so the connection can't be used any further. n <= 0 means no limit.
+func WithMaxBodySize(n int) Option {
+	return func(o *options) {
+		o.maxBodySize = n
+	}
+}
+
+// WithChecksum sets the algorithm the client codec checksums its requests
+// with, the server codec answers with the algorithm of the request. The
+// default is checksum.IEEE.
+func WithChecksum(t checksum.Type) Option {
+	return func(o *options) {
+		o.checksumType = t
+	}
+}
+
+// WithChecksumRequired makes the codec refuse bodies sent with checksum.None
+// with ChecksumRequiredError. Bodies that carry a checksum are always
+// verified.
+func WithChecksumRequired(required bool) Option {
+	return func(o *options) {
+		o.requireChecksum = required
+	}
+}
+
+// WithHello gives the server codec the client hello accepted in the
+// handshake. Responses are then compressed with the negotiated compressor,
+// and requests sent with another serializer, or compressed with another
+// compressor, are refused.
+func WithHello(hello *Hello) Option {
+	return func(o *options) {
+		o.hello = hello
+	}
+}
+
+func (o *options) checkBodySize(size uint32) error {
+	if o.maxBodySize > 0 && uint64(size) > uint64(o.maxBodySize) {
+		return fmt.Errorf("%w: %d bytes, limit is %d", BodyTooLargeError, size, o.maxBodySize)
+	}
+	return nil
+}
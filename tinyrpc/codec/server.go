@@ -2,126 +2,202 @@ package codec
 
 import (
 	"bufio"
+	"github.com/braver-braver/tinyrpc/checksum"
 	"github.com/braver-braver/tinyrpc/compressor"
 	"github.com/braver-braver/tinyrpc/header"
+	"github.com/braver-braver/tinyrpc/internal/bufpool"
 	"github.com/braver-braver/tinyrpc/serializer"
-	"hash/crc32"
 	"io"
-	"net/rpc"
 	"sync"
 )
 
 type reqCtx struct {
-	requestID   uint64
-	compareType compressor.CompressType
+	requestID     uint64
+	compressType  compressor.CompressType
+	serializeType serializer.SerializeType
+	checksumType  checksum.Type
+	noReply       bool // the request is one-way or was cancelled
 }
 
 type serverCodec struct {
-	r io.Reader
-	w io.Writer
+	r *bufio.Reader
+	w *bufio.Writer
 	c io.Closer
 
 	requestHeader header.RequestHeader
-	serializer    serializer.Serializer
+	headerBuf     []byte // the last header read, reused for the next one
+	bodyBuf       []byte // the last body decompressed, reused for the next one
+	options       options
 	mutex         sync.Mutex
 	seq           uint64
-	pending       map[uint64]*reqCtx
+	pending       map[uint64]reqCtx
+	streams       map[uint64]reqCtx // open streams
+	ids           map[uint64]uint64 // seq of the calls and streams, by the client's ID
 }
 
-func NewServerCodec(conn io.ReadWriteCloser, serializer serializer.Serializer) rpc.ServerCodec {
-	return &serverCodec{
-		r:          bufio.NewReader(conn),
-		w:          bufio.NewWriter(conn),
-		c:          conn,
-		serializer: serializer,
-		pending:    make(map[uint64]*reqCtx),
+// NewServerCodec creates a ServerCodec on conn. Every request is decoded with
+// the serializer named in its header and answered with the same one, which
+// has to be the one of the handshake if WithHello is given.
+func NewServerCodec(conn io.ReadWriteCloser, opts ...Option) ServerCodec {
+	s := &serverCodec{
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+		c:       conn,
+		pending: make(map[uint64]reqCtx),
+		streams: make(map[uint64]reqCtx),
+		ids:     make(map[uint64]uint64),
 	}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	return s
 }
 
 // ReadRequestHeader reads the rpc request header from io stream.
-func (s *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+func (s *serverCodec) ReadRequestHeader(r *Request) error {
 	s.requestHeader.ResetHeader()
-	data, err := receiveFrame(s.r)
+	data, err := receiveFrame(s.r, s.options.maxHeaderSize, s.headerBuf)
 	if err != nil {
 		return err
 	}
+	s.headerBuf = data
 	err = s.requestHeader.Unmarshall(data)
 	if err != nil {
 		return err
 	}
-	s.mutex.Lock()
-	s.seq++
-	s.pending[s.seq] = &reqCtx{
+	ctx := reqCtx{
 		s.requestHeader.ID,
 		s.requestHeader.GetCompressType(),
+		s.requestHeader.SerializeType,
+		s.requestHeader.ChecksumType,
+		s.requestHeader.FrameType == header.FrameOneWay,
+	}
+	if s.options.hello != nil {
+		// small requests come Raw, the responses are compressed anyway
+		ctx.compressType = s.options.hello.CompressType
+	}
+	s.mutex.Lock()
+	switch s.requestHeader.FrameType {
+	case header.FrameUnary, header.FrameOneWay, header.FrameStreamOpen:
+		// calls and streams are numbered by the server, so that a client
+		// reusing an ID can't mix them up.
+		s.seq++
+		if s.requestHeader.FrameType == header.FrameStreamOpen {
+			// the frames of the stream are answered like the one opening it
+			s.streams[s.seq] = ctx
+		} else {
+			s.pending[s.seq] = ctx
+		}
+		s.ids[ctx.requestID] = s.seq
+		r.Seq = s.seq
+	case header.FrameCancel:
+		r.Seq = s.ids[ctx.requestID]
+		s.cancelLocked(r.Seq)
+	case header.FramePing, header.FramePong:
+		r.Seq = ctx.requestID
+	default:
+		// 0 for the frames of ended streams, no stream has that seq
+		r.Seq = s.ids[ctx.requestID]
 	}
 	r.ServiceMethod = s.requestHeader.Method
-	r.Seq = s.seq
+	r.Type = s.requestHeader.FrameType
+	r.Window = s.requestHeader.Window
+	r.Timeout = s.requestHeader.Timeout
+	r.Metadata = s.requestHeader.Metadata
 	s.mutex.Unlock()
 	return nil
 }
 
 // ReadRequestBody reads the rpc request body from io stream.
 func (s *serverCodec) ReadRequestBody(param any) error {
+	if err := s.options.checkBodySize(s.requestHeader.RequestLen); err != nil {
+		return err
+	}
 	if param == nil {
-		if s.requestHeader.RequestLen != 0 {
-			if err := read(s.r, make([]byte, s.requestHeader.RequestLen)); err != nil {
-				return err
-			}
-		}
-		return nil
+		return discard(s.r, s.requestHeader.RequestLen)
 	}
 
-	reqBody := make([]byte, s.requestHeader.RequestLen)
-	err := read(s.r, reqBody)
+	buf, err := readBody(s.r, s.requestHeader.RequestLen)
 	if err != nil {
 		return err
 	}
+	defer bufpool.Put(buf)
+	reqBody := *buf
+	if hello := s.options.hello; hello != nil {
+		// small bodies may be sent Raw, see WithMinCompressLen
+		if ct := s.requestHeader.GetCompressType(); ct != hello.CompressType && ct != compressor.Raw {
+			return CompressorTypeMismatchError
+		}
+		if s.requestHeader.SerializeType != hello.SerializeType {
+			return SerializerTypeMismatchError
+		}
+	}
 	if _, ok := compressor.Compressors[s.requestHeader.CompressType]; !ok {
 		return NotFoundCompressorError
 	}
-	if s.requestHeader.Checksum != 0 && crc32.ChecksumIEEE(reqBody) != s.requestHeader.Checksum {
-		return UnexpectedChecksumError
+	serializer, ok := serializer.Lookup(s.requestHeader.SerializeType)
+	if !ok {
+		return NotFoundSerializerError
+	}
+	if err = s.options.verifyChecksum(s.requestHeader.ChecksumType, s.requestHeader.Checksum, reqBody); err != nil {
+		return err
 	}
 
-	req, err := compressor.Compressors[s.requestHeader.CompressType].Decompress(reqBody)
+	req, err := decompressBody(compressor.Compressors[s.requestHeader.CompressType], &s.bodyBuf, reqBody, s.options.maxMessageSize)
 	if err != nil {
 		return err
 	}
-	return s.serializer.UnMarshal(req, param)
+	return decodeBody(serializer, req, param)
 }
 
-// WriteResponse Write the rpc response header and body to the io stream
-func (s *serverCodec) WriteResponse(response *rpc.Response, param any) error {
+// WriteResponse Write the rpc response header and body to the io stream.
+// Nothing is written for one-way and cancelled requests.
+func (s *serverCodec) WriteResponse(response *Response, param any) error {
 	s.mutex.Lock()
-	reqCtx, ok := s.pending[response.Seq]
+	reqCtx, ok := s.lookupLocked(response)
+	s.mutex.Unlock()
 	if !ok {
-		s.mutex.Unlock()
 		return InvalidSequenceError
 	}
-	delete(s.pending, response.Seq)
-	s.mutex.Unlock()
+	if reqCtx.noReply {
+		return nil
+	}
 
 	if response.Error != "" {
 		param = nil
 	}
-	if _, ok := compressor.Compressors[reqCtx.compareType]; !ok {
+	if _, ok := compressor.Compressors[reqCtx.compressType]; !ok {
 		return NotFoundCompressorError
 	}
 
 	var respBody []byte
 	var err error
 	if param != nil {
-		respBody, err = s.serializer.Marshal(param)
+		serializer, ok := serializer.Lookup(reqCtx.serializeType)
+		if !ok {
+			return NotFoundSerializerError
+		}
+		var buf *[]byte
+		respBody, buf, err = marshalBody(serializer, param)
 		if err != nil {
 			return err
 		}
+		if buf != nil {
+			defer bufpool.Put(buf)
+		}
 	}
 
-	compressedResponseBody, err := compressor.Compressors[reqCtx.compareType].Compress(respBody)
+	compressType := reqCtx.compressType
+	if len(respBody) < s.options.minCompressLen {
+		compressType = compressor.Raw
+	}
+	compressedResponseBody, buf, err := compressBody(compressor.Compressors[compressType], respBody)
 	if err != nil {
 		return err
 	}
+	if buf != nil {
+		defer bufpool.Put(buf)
+	}
 
 	h := header.ResponsePool.Get().(*header.ResponseHeader)
 	defer func() {
@@ -131,22 +207,61 @@ func (s *serverCodec) WriteResponse(response *rpc.Response, param any) error {
 
 	h.ID = reqCtx.requestID
 	h.Error = response.Error
-	h.Checksum = crc32.ChecksumIEEE(compressedResponseBody)
-	h.CompressType = reqCtx.compareType
+	h.Code = response.Code
+	h.Details = response.Details
+	h.Metadata = response.Metadata
+	h.ChecksumType = reqCtx.checksumType
+	h.Checksum = reqCtx.checksumType.Sum(compressedResponseBody)
+	h.CompressType = compressType
+	h.SerializeType = reqCtx.serializeType
 	h.ResponseLen = uint32(len(compressedResponseBody))
+	h.FrameType = response.Type
+	h.Window = response.Window
 
-	if err = sendFrame(s.w, h.Marshall()); err != nil {
-		return err
+	return sendFrame(s.w, h, compressedResponseBody)
+}
+
+// lookupLocked finds the request response answers. Unary requests and
+// ended streams are forgotten.
+func (s *serverCodec) lookupLocked(response *Response) (reqCtx, bool) {
+	switch response.Type {
+	case header.FramePing, header.FramePong:
+		// keepalive frames belong to no call, they have no body.
+		return reqCtx{requestID: response.Seq}, true
+	case header.FrameUnary:
+		ctx, ok := s.pending[response.Seq]
+		if ok {
+			delete(s.pending, response.Seq)
+			s.forgetLocked(ctx.requestID, response.Seq)
+		}
+		return ctx, ok
+	}
+	ctx, ok := s.streams[response.Seq]
+	if ok && response.Type == header.FrameStreamEnd {
+		delete(s.streams, response.Seq)
+		s.forgetLocked(ctx.requestID, response.Seq)
 	}
+	return ctx, ok
+}
 
-	if err = write(s.w, compressedResponseBody); err != nil {
-		return err
+// forgetLocked drops the ID of the call or stream seq, unless the client
+// reused it since.
+func (s *serverCodec) forgetLocked(id, seq uint64) {
+	if s.ids[id] == seq {
+		delete(s.ids, id)
 	}
-	err = s.w.(*bufio.Writer).Flush()
-	if err != nil {
-		return err
+}
+
+// cancelLocked makes sure nothing more is written for the call or the stream
+// seq.
+func (s *serverCodec) cancelLocked(seq uint64) {
+	if ctx, ok := s.pending[seq]; ok {
+		ctx.noReply = true
+		s.pending[seq] = ctx
+	} else if ctx, ok := s.streams[seq]; ok {
+		ctx.noReply = true
+		s.streams[seq] = ctx
 	}
-	return nil
 }
 
 func (s *serverCodec) Close() error {
@@ -0,0 +1,79 @@
+// Package codes defines the error codes tinyrpc responses carry. The values
+// match those of gRPC.
+package codes
+
+import "strconv"
+
+// Code classifies the error of a call.
+type Code uint16
+
+const (
+	// OK means the call succeeded.
+	OK Code = iota
+	// Canceled means the call was canceled, typically by the caller.
+	Canceled
+	// Unknown is the code of errors that carry no other one, e.g. those
+	// returned by handlers as plain errors or sent by peers that don't send
+	// codes.
+	Unknown
+	// InvalidArgument means the request is malformed, regardless of the
+	// state of the server.
+	InvalidArgument
+	// DeadlineExceeded means the deadline expired before the call completed.
+	DeadlineExceeded
+	// NotFound means a requested entity was not found.
+	NotFound
+	// AlreadyExists means an entity the call tried to create already exists.
+	AlreadyExists
+	// PermissionDenied means the caller is not allowed to make the call.
+	PermissionDenied
+	// ResourceExhausted means a resource, e.g. a quota or the size limit of a
+	// message, has been exhausted.
+	ResourceExhausted
+	// FailedPrecondition means the server is not in the state the call
+	// requires.
+	FailedPrecondition
+	// Aborted means the call was aborted, e.g. because of a concurrency
+	// conflict.
+	Aborted
+	// OutOfRange means the call went past a valid range.
+	OutOfRange
+	// Unimplemented means the server doesn't implement the method.
+	Unimplemented
+	// Internal means an invariant of the server is broken.
+	Internal
+	// Unavailable means the server is currently unavailable, the call may be
+	// retried.
+	Unavailable
+	// DataLoss means unrecoverable data loss or corruption.
+	DataLoss
+	// Unauthenticated means the caller could not be authenticated.
+	Unauthenticated
+)
+
+var names = [...]string{
+	OK:                 "OK",
+	Canceled:           "Canceled",
+	Unknown:            "Unknown",
+	InvalidArgument:    "InvalidArgument",
+	DeadlineExceeded:   "DeadlineExceeded",
+	NotFound:           "NotFound",
+	AlreadyExists:      "AlreadyExists",
+	PermissionDenied:   "PermissionDenied",
+	ResourceExhausted:  "ResourceExhausted",
+	FailedPrecondition: "FailedPrecondition",
+	Aborted:            "Aborted",
+	OutOfRange:         "OutOfRange",
+	Unimplemented:      "Unimplemented",
+	Internal:           "Internal",
+	Unavailable:        "Unavailable",
+	DataLoss:           "DataLoss",
+	Unauthenticated:    "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if int(c) < len(names) {
+		return names[c]
+	}
+	return "Code(" + strconv.Itoa(int(c)) + ")"
+}
@@ -0,0 +1,41 @@
+package codes
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCode(t *testing.T) {
+	cases := []struct {
+		code  Code
+		value uint16
+		name  string
+	}{
+		{OK, 0, "OK"},
+		{Canceled, 1, "Canceled"},
+		{Unknown, 2, "Unknown"},
+		{InvalidArgument, 3, "InvalidArgument"},
+		{DeadlineExceeded, 4, "DeadlineExceeded"},
+		{NotFound, 5, "NotFound"},
+		{AlreadyExists, 6, "AlreadyExists"},
+		{PermissionDenied, 7, "PermissionDenied"},
+		{ResourceExhausted, 8, "ResourceExhausted"},
+		{FailedPrecondition, 9, "FailedPrecondition"},
+		{Aborted, 10, "Aborted"},
+		{OutOfRange, 11, "OutOfRange"},
+		{Unimplemented, 12, "Unimplemented"},
+		{Internal, 13, "Internal"},
+		{Unavailable, 14, "Unavailable"},
+		{DataLoss, 15, "DataLoss"},
+		{Unauthenticated, 16, "Unauthenticated"},
+		{17, 17, "Code(17)"},
+		{1000, 1000, "Code(1000)"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// the values go on the wire, they must stay those of gRPC
+			assert.Equal(t, c.value, uint16(c.code))
+			assert.Equal(t, c.name, c.code.String())
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package compressor
 
+import (
+	"errors"
+	"fmt"
+)
+
 type CompressType uint16
 
 const (
@@ -7,16 +12,86 @@ const (
 	Gzip
 	Snappy
 	Zlib
+	Zstd
+	LZ4
 )
 
+// Compressor compresses the bodies of calls. Neither method may keep its
+// input, the codecs reuse it once they return.
 type Compressor interface {
 	Compress([]byte) ([]byte, error)
 	Decompress([]byte) ([]byte, error)
 }
 
+// LimitedDecompressor is implemented by compressors that stop as soon as the
+// decompressed data grows beyond limit bytes, instead of inflating it all.
+type LimitedDecompressor interface {
+	DecompressLimit(data []byte, limit int) ([]byte, error)
+}
+
+// AppendCompressor is implemented by compressors that can write into a
+// buffer of the caller, the codecs use it with pooled buffers. Both methods
+// append their output to dst and return the extended slice, DecompressAppend
+// stops like DecompressLimit.
+type AppendCompressor interface {
+	Compressor
+	CompressAppend(dst, data []byte) ([]byte, error)
+	DecompressAppend(dst, data []byte, limit int) ([]byte, error)
+}
+
+var (
+	NilCompressorError        = errors.New("compressor is nil")
+	CompressorRegisteredError = errors.New("compressor type already registered")
+	MessageTooLargeError      = errors.New("decompressed message too large")
+)
+
+// Compressors holds the compressors known to this process, keyed by the type
+// that travels in the request and response headers. Use RegisterCompressor to
+// add one.
 var Compressors = map[CompressType]Compressor{
 	Raw:    RawCompressor{},
 	Gzip:   GzipCompressor{},
 	Snappy: SnappyCompressor{},
 	Zlib:   ZlibCompressor{},
+	Zstd:   ZstdCompressor{},
+	LZ4:    LZ4Compressor{},
+}
+
+// Decompress decompresses data with c and fails with MessageTooLargeError if
+// the result is larger than limit bytes, a limit <= 0 means no limit.
+// Compressors that don't implement LimitedDecompressor are only checked once
+// they are done.
+func Decompress(c Compressor, data []byte, limit int) ([]byte, error) {
+	if limit <= 0 {
+		return c.Decompress(data)
+	}
+	if l, ok := c.(LimitedDecompressor); ok {
+		return l.DecompressLimit(data, limit)
+	}
+	data, err := c.Decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, tooLarge(limit)
+	}
+	return data, nil
+}
+
+func tooLarge(limit int) error {
+	return fmt.Errorf("%w: limit is %d bytes", MessageTooLargeError, limit)
+}
+
+// RegisterCompressor makes c available under t, to both clients and servers.
+// It is not safe for concurrent use with running codecs, call it during
+// initialization. It fails if t is taken already.
+func RegisterCompressor(t CompressType, c Compressor) error {
+	if c == nil {
+		return NilCompressorError
+	}
+	if _, dup := Compressors[t]; dup {
+		return fmt.Errorf("%w: %d", CompressorRegisteredError, t)
+	}
+	Compressors[t] = c
+	return nil
 }
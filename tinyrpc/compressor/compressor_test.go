@@ -0,0 +1,197 @@
+package compressor
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var compressorNames = map[CompressType]string{
+	Raw: "raw", Gzip: "gzip", Snappy: "snappy", Zlib: "zlib", Zstd: "zstd", LZ4: "lz4", custom: "custom",
+}
+
+// payload looks like a batch of log records, repetitive but not trivially so.
+func payload(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, `{"id":%d,"level":"info","service":"arith","latency_ms":%d,"msg":"call %d done"}`+"\n", i, i*7%113, i%17)
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestCompressors_RoundTrip(t *testing.T) {
+	for ct, c := range Compressors {
+		for _, size := range []int{0, 1, 100, 64 << 10} {
+			t.Run(fmt.Sprintf("%s/%d", compressorNames[ct], size), func(t *testing.T) {
+				data := payload(size)
+				compressed, err := c.Compress(data)
+				assert.NoError(t, err)
+				decompressed, err := c.Decompress(compressed)
+				assert.NoError(t, err)
+				assert.Equal(t, len(data), len(decompressed))
+				assert.True(t, bytes.Equal(data, decompressed))
+			})
+		}
+	}
+}
+
+func TestCompressors_Append(t *testing.T) {
+	data := payload(16 << 10)
+	for ct, c := range Compressors {
+		a, ok := c.(AppendCompressor)
+		if !ok {
+			continue
+		}
+		t.Run(compressorNames[ct], func(t *testing.T) {
+			// the output follows what dst holds already
+			compressed, err := a.CompressAppend([]byte("prefix"), data)
+			assert.NoError(t, err)
+			assert.Equal(t, "prefix", string(compressed[:6]))
+			decompressed, err := a.DecompressAppend([]byte("prefix"), compressed[6:], 0)
+			assert.NoError(t, err)
+			assert.Equal(t, "prefix", string(decompressed[:6]))
+			assert.True(t, bytes.Equal(data, decompressed[6:]))
+
+			_, err = a.DecompressAppend(nil, compressed[6:], 8<<10)
+			assert.ErrorIs(t, err, MessageTooLargeError)
+			decompressed, err = a.DecompressAppend(make([]byte, 0, 1), compressed[6:], len(data))
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(data, decompressed))
+		})
+	}
+}
+
+// BenchmarkCompressors reports the throughput of each compressor along with
+// its ratio, the uncompressed size divided by the compressed size.
+func BenchmarkCompressors(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10, 1 << 20} {
+		data := payload(size)
+		for ct := Raw; ct <= LZ4; ct++ {
+			c := Compressors[ct]
+			compressed, err := c.Compress(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ratio := float64(len(data)) / float64(len(compressed))
+			name := fmt.Sprintf("%s/%dKB", compressorNames[ct], size>>10)
+			b.Run(name+"/Compress", func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := c.Compress(data); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(ratio, "ratio")
+			})
+			b.Run(name+"/Decompress", func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := c.Decompress(compressed); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(ratio, "ratio")
+			})
+		}
+	}
+}
+
+type reverseCompressor struct{}
+
+func (reverseCompressor) Compress(data []byte) ([]byte, error) {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[len(data)-1-i] = b
+	}
+	return out, nil
+}
+
+func (r reverseCompressor) Decompress(data []byte) ([]byte, error) {
+	return r.Compress(data)
+}
+
+// custom is the type the tests use for reverseCompressor.
+const custom CompressType = 0x100
+
+func TestRegisterCompressor(t *testing.T) {
+	defer delete(Compressors, custom)
+
+	assert.ErrorIs(t, RegisterCompressor(custom, nil), NilCompressorError)
+	assert.ErrorIs(t, RegisterCompressor(Gzip, reverseCompressor{}), CompressorRegisteredError)
+	assert.Equal(t, GzipCompressor{}, Compressors[Gzip])
+
+	assert.NoError(t, RegisterCompressor(custom, reverseCompressor{}))
+	assert.Equal(t, reverseCompressor{}, Compressors[custom])
+	assert.ErrorIs(t, RegisterCompressor(custom, reverseCompressor{}), CompressorRegisteredError)
+}
+
+func TestCompressors_Corrupt(t *testing.T) {
+	for _, ct := range []CompressType{Gzip, Snappy, Zlib, Zstd, LZ4} {
+		t.Run(compressorNames[ct], func(t *testing.T) {
+			c := Compressors[ct]
+			compressed, err := c.Compress(payload(4 << 10))
+			assert.NoError(t, err)
+			_, err = c.Decompress(compressed[:len(compressed)/2])
+			assert.Error(t, err)
+			corrupt := bytes.Clone(compressed)
+			corrupt[len(corrupt)/2] ^= 0xff
+			_, err = c.Decompress(corrupt)
+			assert.Error(t, err)
+			// the pooled state must still work after a failure
+			data, err := c.Decompress(compressed)
+			assert.NoError(t, err)
+			assert.Equal(t, payload(4<<10), data)
+		})
+	}
+}
+
+// BenchmarkCompressors_Parallel measures the allocations of the pooled
+// compressors under concurrent use, as seen on busy servers.
+func BenchmarkCompressors_Parallel(b *testing.B) {
+	data := payload(1 << 10)
+	for ct := Raw; ct <= LZ4; ct++ {
+		c := Compressors[ct]
+		b.Run(compressorNames[ct], func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					compressed, err := c.Compress(data)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err = c.Decompress(compressed); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestDecompress_Limit(t *testing.T) {
+	bomb := make([]byte, 2<<20)
+	compressors := map[CompressType]Compressor{custom: reverseCompressor{}}
+	for ct, c := range Compressors {
+		compressors[ct] = c
+	}
+	for ct, c := range compressors {
+		t.Run(compressorNames[ct], func(t *testing.T) {
+			compressed, err := c.Compress(bomb)
+			assert.NoError(t, err)
+
+			_, err = Decompress(c, compressed, 256<<10)
+			assert.ErrorIs(t, err, MessageTooLargeError)
+
+			data, err := Decompress(c, compressed, len(bomb))
+			assert.NoError(t, err)
+			assert.Len(t, data, len(bomb))
+			data, err = Decompress(c, compressed, 0)
+			assert.NoError(t, err)
+			assert.Len(t, data, len(bomb))
+		})
+	}
+}
@@ -3,46 +3,86 @@ package compressor
 import (
 	"bytes"
 	"compress/gzip"
-	"io"
-	"log"
+	"sync"
 )
 
+var (
+	gzipWriterPool = sync.Pool{
+		New: func() any {
+			gw := &gzipWriter{}
+			gw.w = gzip.NewWriter(&gw.dst)
+			return gw
+		},
+	}
+	gzipReaderPool sync.Pool // *gzipReader
+)
+
+// gzipWriter is a pooled gzip writer, see sliceWriter.
+type gzipWriter struct {
+	dst sliceWriter
+	w   *gzip.Writer
+}
+
+// gzipReader is a pooled gzip reader.
+type gzipReader struct {
+	src bytes.Reader
+	r   gzip.Reader
+}
+
 type GzipCompressor struct{}
 
-func (_ GzipCompressor) Compress(data []byte) ([]byte, error) {
-	buf := bytes.NewBuffer(nil)
-	w := gzip.NewWriter(buf)
-	defer func(w *gzip.Writer) {
-		err := w.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}(w)
-	_, err := w.Write(data)
-	if err != nil {
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	return appendCopy(func(dst []byte) ([]byte, error) {
+		return c.CompressAppend(dst, data)
+	})
+}
+
+func (_ GzipCompressor) CompressAppend(dst, data []byte) ([]byte, error) {
+	gw := gzipWriterPool.Get().(*gzipWriter)
+	defer func() {
+		gw.dst.b = nil
+		gzipWriterPool.Put(gw)
+	}()
+	gw.dst.b = dst
+	gw.w.Reset(&gw.dst)
+
+	if _, err := gw.w.Write(data); err != nil {
 		return nil, err
 	}
-	err = w.Flush()
-	if err != nil {
+	// Close writes the gzip footer, the stream is incomplete without it.
+	if err := gw.w.Close(); err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), err
+	return gw.dst.b, nil
+}
+
+func (c GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.DecompressLimit(data, 0)
+}
+
+func (c GzipCompressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	return appendCopy(func(dst []byte) ([]byte, error) {
+		return c.DecompressAppend(dst, data, limit)
+	})
 }
 
-func (_ GzipCompressor) Decompress(data []byte) ([]byte, error) {
-	r, err := gzip.NewReader(bytes.NewBuffer(data))
+func (_ GzipCompressor) DecompressAppend(dst, data []byte, limit int) ([]byte, error) {
+	gr, _ := gzipReaderPool.Get().(*gzipReader)
+	if gr == nil {
+		gr = &gzipReader{}
+	}
+	gr.src.Reset(data)
+	if err := gr.r.Reset(&gr.src); err != nil {
+		return nil, err
+	}
+	defer gzipReaderPool.Put(gr)
+
+	dst, err := readAppend(dst, &gr.r, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer func(r *gzip.Reader) {
-		err := r.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}(r)
-	data, err = io.ReadAll(r)
-	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+	if err = gr.r.Close(); err != nil {
 		return nil, err
 	}
-	return data, nil
+	return dst, nil
 }
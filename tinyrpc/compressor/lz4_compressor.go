@@ -0,0 +1,84 @@
+package compressor
+
+import (
+	"bytes"
+	"github.com/pierrec/lz4/v4"
+	"sync"
+)
+
+var (
+	lz4WriterPool = sync.Pool{
+		New: func() any {
+			lw := &lz4Writer{}
+			lw.w = lz4.NewWriter(&lw.dst)
+			// bodies are small, the default 4 MiB blocks would be allocated
+			// for every writer.
+			_ = lw.w.Apply(lz4.BlockSizeOption(lz4.Block64Kb))
+			return lw
+		},
+	}
+	lz4ReaderPool = sync.Pool{
+		New: func() any {
+			return &lz4Reader{r: lz4.NewReader(nil)}
+		},
+	}
+)
+
+// lz4Writer is a pooled lz4 writer, see sliceWriter.
+type lz4Writer struct {
+	dst sliceWriter
+	w   *lz4.Writer
+}
+
+// lz4Reader is a pooled lz4 reader.
+type lz4Reader struct {
+	src bytes.Reader
+	r   *lz4.Reader
+}
+
+// LZ4Compressor compresses each body as an LZ4 frame, whose content checksum
+// catches corrupted and truncated bodies.
+type LZ4Compressor struct{}
+
+func (c LZ4Compressor) Compress(data []byte) ([]byte, error) {
+	return appendCopy(func(dst []byte) ([]byte, error) {
+		return c.CompressAppend(dst, data)
+	})
+}
+
+func (_ LZ4Compressor) CompressAppend(dst, data []byte) ([]byte, error) {
+	lw := lz4WriterPool.Get().(*lz4Writer)
+	defer func() {
+		lw.dst.b = nil
+		lz4WriterPool.Put(lw)
+	}()
+	lw.dst.b = dst
+	lw.w.Reset(&lw.dst)
+
+	if _, err := lw.w.Write(data); err != nil {
+		return nil, err
+	}
+	// Close writes the end mark and the content checksum.
+	if err := lw.w.Close(); err != nil {
+		return nil, err
+	}
+	return lw.dst.b, nil
+}
+
+func (c LZ4Compressor) Decompress(data []byte) ([]byte, error) {
+	return c.DecompressLimit(data, 0)
+}
+
+func (c LZ4Compressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	return appendCopy(func(dst []byte) ([]byte, error) {
+		return c.DecompressAppend(dst, data, limit)
+	})
+}
+
+func (_ LZ4Compressor) DecompressAppend(dst, data []byte, limit int) ([]byte, error) {
+	lr := lz4ReaderPool.Get().(*lz4Reader)
+	defer lz4ReaderPool.Put(lr)
+	lr.src.Reset(data)
+	lr.r.Reset(&lr.src)
+	return readAppend(dst, lr.r, limit)
+}
@@ -0,0 +1,79 @@
+package compressor
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize keeps the occasional huge body from pinning its buffer
+// in the pool forever.
+const maxPooledBufferSize = 1 << 20
+
+// bufferPool holds the buffers Compress and Decompress work in. Unlike the
+// size classes of the codecs' pool, a buffer is handed out again however
+// much it grew, as the size of the output is not known up front.
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new([]byte)
+	},
+}
+
+// The stream compressors keep their writers and readers in pools, as creating
+// them costs more than most bodies take to compress. A pooled writer comes
+// with the sliceWriter it writes into and a pooled reader with the
+// bytes.Reader it reads from, so that each body only resets them.
+
+// sliceWriter appends what is written to it to b, the pooled writers write
+// into the buffer of the caller through it.
+type sliceWriter struct {
+	b []byte
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	return len(p), nil
+}
+
+// appendCopy runs fn on a pooled buffer and returns a copy of the result,
+// the caller owns the returned slice.
+func appendCopy(fn func(dst []byte) ([]byte, error)) ([]byte, error) {
+	buf := bufferPool.Get().(*[]byte)
+	out, err := fn((*buf)[:0])
+	if err != nil {
+		bufferPool.Put(buf)
+		return nil, err
+	}
+	if cap(out) <= maxPooledBufferSize {
+		// keep the buffer if fn had to grow it
+		*buf = out[:0]
+		bufferPool.Put(buf)
+	}
+	return bytes.Clone(out), nil
+}
+
+// readAppend reads r to the end, appending to dst. It stops reading once more
+// than limit bytes came in, a limit <= 0 means no limit.
+func readAppend(dst []byte, r io.Reader, limit int) ([]byte, error) {
+	start := len(dst)
+	for {
+		if len(dst) == cap(dst) {
+			dst = append(dst, 0)[:len(dst)]
+		}
+		free := dst[len(dst):cap(dst)]
+		if left := limit + 1 - (len(dst) - start); limit > 0 && len(free) > left {
+			free = free[:left]
+		}
+		n, err := r.Read(free)
+		dst = dst[:len(dst)+n]
+		if limit > 0 && len(dst)-start > limit {
+			return nil, tooLarge(limit)
+		}
+		if err == io.EOF {
+			return dst, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
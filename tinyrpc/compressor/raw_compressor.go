@@ -9,3 +9,10 @@ func (_ RawCompressor) Compress(data []byte) ([]byte, error) {
 func (_ RawCompressor) Decompress(data []byte) ([]byte, error) {
 	return data, nil
 }
+
+func (_ RawCompressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	if limit > 0 && len(data) > limit {
+		return nil, tooLarge(limit)
+	}
+	return data, nil
+}
@@ -3,36 +3,76 @@ package compressor
 import (
 	"bytes"
 	"github.com/klauspost/compress/snappy"
-	"io"
+	"sync"
 )
 
+var (
+	snappyWriterPool = sync.Pool{
+		New: func() any {
+			sw := &snappyWriter{}
+			sw.w = snappy.NewBufferedWriter(&sw.dst)
+			return sw
+		},
+	}
+	snappyReaderPool = sync.Pool{
+		New: func() any {
+			return &snappyReader{r: snappy.NewReader(nil)}
+		},
+	}
+)
+
+// snappyWriter is a pooled snappy writer, see sliceWriter.
+type snappyWriter struct {
+	dst sliceWriter
+	w   *snappy.Writer
+}
+
+// snappyReader is a pooled snappy reader.
+type snappyReader struct {
+	src bytes.Reader
+	r   *snappy.Reader
+}
+
 type SnappyCompressor struct{}
 
-func (_ SnappyCompressor) Compress(data []byte) ([]byte, error) {
-	buf := bytes.NewBuffer(nil)
-	w := snappy.NewBufferedWriter(buf)
-	defer func(w *snappy.Writer) {
-		err := w.Close()
-		if err != nil {
-
-		}
-	}(w)
-	_, err := w.Write(data)
-	if err != nil {
+func (c SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return appendCopy(func(dst []byte) ([]byte, error) {
+		return c.CompressAppend(dst, data)
+	})
+}
+
+func (_ SnappyCompressor) CompressAppend(dst, data []byte) ([]byte, error) {
+	sw := snappyWriterPool.Get().(*snappyWriter)
+	defer func() {
+		sw.dst.b = nil
+		snappyWriterPool.Put(sw)
+	}()
+	sw.dst.b = dst
+	sw.w.Reset(&sw.dst)
+
+	if _, err := sw.w.Write(data); err != nil {
 		return nil, err
 	}
-	err = w.Flush()
-	if err != nil {
+	if err := sw.w.Close(); err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return sw.dst.b, nil
 }
 
-func (_ SnappyCompressor) Decompress(data []byte) ([]byte, error) {
-	r := snappy.NewReader(bytes.NewBuffer(data))
-	data, err := io.ReadAll(r)
-	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-		return nil, err
-	}
-	return data, nil
+func (c SnappyCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.DecompressLimit(data, 0)
+}
+
+func (c SnappyCompressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	return appendCopy(func(dst []byte) ([]byte, error) {
+		return c.DecompressAppend(dst, data, limit)
+	})
+}
+
+func (_ SnappyCompressor) DecompressAppend(dst, data []byte, limit int) ([]byte, error) {
+	sr := snappyReaderPool.Get().(*snappyReader)
+	defer snappyReaderPool.Put(sr)
+	sr.src.Reset(data)
+	sr.r.Reset(&sr.src)
+	return readAppend(dst, sr.r, limit)
 }
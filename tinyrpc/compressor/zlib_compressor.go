@@ -4,45 +4,94 @@ import (
 	"bytes"
 	"compress/zlib"
 	"io"
+	"sync"
 )
 
+var (
+	zlibWriterPool = sync.Pool{
+		New: func() any {
+			zw := &zlibWriter{}
+			zw.w = zlib.NewWriter(&zw.dst)
+			return zw
+		},
+	}
+	zlibReaderPool sync.Pool // *zlibReader
+)
+
+// zlibWriter is a pooled zlib writer, see sliceWriter.
+type zlibWriter struct {
+	dst sliceWriter
+	w   *zlib.Writer
+}
+
+// zlibReader is a pooled zlib reader, r is created on first use.
+type zlibReader struct {
+	src bytes.Reader
+	r   io.ReadCloser
+}
+
 type ZlibCompressor struct {
 }
 
-func (_ ZlibCompressor) Compress(data []byte) ([]byte, error) {
-	buf := bytes.NewBuffer(nil)
-	w := zlib.NewWriter(buf)
-	defer func(w *zlib.Writer) {
-		err := w.Close()
-		if err != nil {
+func (c ZlibCompressor) Compress(data []byte) ([]byte, error) {
+	return appendCopy(func(dst []byte) ([]byte, error) {
+		return c.CompressAppend(dst, data)
+	})
+}
 
-		}
-	}(w)
-	_, err := w.Write(data)
-	if err != nil {
+func (_ ZlibCompressor) CompressAppend(dst, data []byte) ([]byte, error) {
+	zw := zlibWriterPool.Get().(*zlibWriter)
+	defer func() {
+		zw.dst.b = nil
+		zlibWriterPool.Put(zw)
+	}()
+	zw.dst.b = dst
+	zw.w.Reset(&zw.dst)
+
+	if _, err := zw.w.Write(data); err != nil {
 		return nil, err
 	}
-	err = w.Flush()
-	if err != nil {
+	// Close writes the checksum that ends the stream.
+	if err := zw.w.Close(); err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	return zw.dst.b, nil
+}
+
+func (c ZlibCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.DecompressLimit(data, 0)
+}
+
+func (c ZlibCompressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	return appendCopy(func(dst []byte) ([]byte, error) {
+		return c.DecompressAppend(dst, data, limit)
+	})
 }
 
-func (_ ZlibCompressor) Decompress(data []byte) ([]byte, error) {
-	reader, err := zlib.NewReader(bytes.NewBuffer(data))
+func (_ ZlibCompressor) DecompressAppend(dst, data []byte, limit int) ([]byte, error) {
+	zr, _ := zlibReaderPool.Get().(*zlibReader)
+	if zr == nil {
+		zr = &zlibReader{}
+	}
+	zr.src.Reset(data)
+	var err error
+	if zr.r == nil {
+		zr.r, err = zlib.NewReader(&zr.src)
+	} else {
+		err = zr.r.(zlib.Resetter).Reset(&zr.src, nil)
+	}
 	if err != nil {
+		// a reader that failed to start can't be reused.
 		return nil, err
 	}
-	defer func(reader io.ReadCloser) {
-		err := reader.Close()
-		if err != nil {
+	defer zlibReaderPool.Put(zr)
 
-		}
-	}(reader)
-	data, err = io.ReadAll(reader)
-	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+	dst, err = readAppend(dst, zr.r, limit)
+	if err != nil {
+		return nil, err
+	}
+	if err = zr.r.Close(); err != nil {
 		return nil, err
 	}
-	return data, nil
+	return dst, nil
 }
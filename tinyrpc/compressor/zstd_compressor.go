@@ -0,0 +1,76 @@
+package compressor
+
+import (
+	"bytes"
+	"github.com/klauspost/compress/zstd"
+	"sync"
+)
+
+// zstd encoders and decoders are expensive to create, a single pair is shared
+// by all calls. EncodeAll and DecodeAll are safe for concurrent use.
+var (
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func init() {
+	var err error
+	if zstdEncoder, err = zstd.NewWriter(nil); err != nil {
+		panic("compressor: cannot create the zstd encoder: " + err.Error())
+	}
+	if zstdDecoder, err = zstd.NewReader(nil); err != nil {
+		panic("compressor: cannot create the zstd decoder: " + err.Error())
+	}
+}
+
+// zstdReaderPool holds the stream decoders used when the output is limited,
+// DecodeAll would inflate the whole frame first.
+var zstdReaderPool sync.Pool // *zstdReader
+
+type zstdReader struct {
+	src bytes.Reader
+	r   *zstd.Decoder
+}
+
+type ZstdCompressor struct{}
+
+func (_ ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	return zstdEncoder.EncodeAll(data, nil), nil
+}
+
+func (_ ZstdCompressor) CompressAppend(dst, data []byte) ([]byte, error) {
+	return zstdEncoder.EncodeAll(data, dst), nil
+}
+
+func (_ ZstdCompressor) Decompress(data []byte) ([]byte, error) {
+	return zstdDecoder.DecodeAll(data, nil)
+}
+
+func (c ZstdCompressor) DecompressLimit(data []byte, limit int) ([]byte, error) {
+	if limit <= 0 {
+		return c.Decompress(data)
+	}
+	return appendCopy(func(dst []byte) ([]byte, error) {
+		return c.DecompressAppend(dst, data, limit)
+	})
+}
+
+func (_ ZstdCompressor) DecompressAppend(dst, data []byte, limit int) ([]byte, error) {
+	if limit <= 0 {
+		return zstdDecoder.DecodeAll(data, dst)
+	}
+	zr, _ := zstdReaderPool.Get().(*zstdReader)
+	if zr == nil {
+		r, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		zr = &zstdReader{r: r}
+	}
+	defer zstdReaderPool.Put(zr)
+	zr.src.Reset(data)
+	if err := zr.r.Reset(&zr.src); err != nil {
+		return nil, err
+	}
+	return readAppend(dst, zr.r, limit)
+}
@@ -0,0 +1,224 @@
+package tinyrpc
+
+import (
+	"context"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/status"
+	"math/rand"
+	"time"
+)
+
+// ConnectivityState is the state of the connection of a client.
+type ConnectivityState int
+
+const (
+	// Idle clients have no connection, they connect for the next call.
+	Idle ConnectivityState = iota
+	// Connecting clients are dialing, calls wait for the outcome.
+	Connecting
+	// Ready clients have a connection.
+	Ready
+	// TransientFailure clients lost their connection or failed to connect,
+	// they redial after a backoff. Calls fail with codes.Unavailable.
+	TransientFailure
+	// Shutdown clients are closed, or lost the connection NewClient gave
+	// them.
+	Shutdown
+)
+
+func (s ConnectivityState) String() string {
+	switch s {
+	case Idle:
+		return "IDLE"
+	case Connecting:
+		return "CONNECTING"
+	case Ready:
+		return "READY"
+	case TransientFailure:
+		return "TRANSIENT_FAILURE"
+	case Shutdown:
+		return "SHUTDOWN"
+	}
+	return "INVALID_STATE"
+}
+
+// BackoffConfig sets how long a client waits between attempts to reconnect.
+// The first wait is BaseDelay, each next one Multiplier times longer up to
+// MaxDelay, and every wait is randomized by up to Jitter times its length so
+// that clients don't redial in lockstep.
+type BackoffConfig struct {
+	BaseDelay  time.Duration
+	Multiplier float64
+	Jitter     float64
+	MaxDelay   time.Duration
+}
+
+// DefaultBackoffConfig is the backoff of clients without WithBackoff.
+var DefaultBackoffConfig = BackoffConfig{
+	BaseDelay:  time.Second,
+	Multiplier: 1.6,
+	Jitter:     0.2,
+	MaxDelay:   120 * time.Second,
+}
+
+// WithBackoff sets the backoff of the clients of Dial.
+func WithBackoff(b BackoffConfig) Option {
+	return func(o *options) {
+		o.backoff = b
+	}
+}
+
+// delay returns the wait after the given number of failed attempts, counting
+// from 0.
+func (b BackoffConfig) delay(retries int) time.Duration {
+	backoff, max := float64(b.BaseDelay), float64(b.MaxDelay)
+	for backoff < max && retries > 0 {
+		backoff *= b.Multiplier
+		retries--
+	}
+	if backoff > max {
+		backoff = max
+	}
+	backoff *= 1 + b.Jitter*(rand.Float64()*2-1)
+	if backoff < 0 {
+		return 0
+	}
+	return time.Duration(backoff)
+}
+
+// State returns the state of the connection of the client.
+func (c *Client) State() ConnectivityState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.state
+}
+
+// WaitForStateChange waits until the state of the client differs from
+// source. It reports false if ctx is done first.
+func (c *Client) WaitForStateChange(ctx context.Context, source ConnectivityState) bool {
+	c.mutex.Lock()
+	state, changed := c.state, c.stateChanged
+	c.mutex.Unlock()
+	if state != source {
+		return true
+	}
+	select {
+	case <-changed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// WaitForReady waits until the client is Ready, connecting it if it is Idle.
+// It returns ctx.Err() if ctx is done first and ErrShutdown once the client
+// is shut down.
+func (c *Client) WaitForReady(ctx context.Context) error {
+	for {
+		if err := c.awaitConn(ctx); err != nil {
+			return err
+		}
+		c.mutex.Lock()
+		state, changed := c.state, c.stateChanged
+		c.mutex.Unlock()
+		switch state {
+		case Ready:
+			return nil
+		case Shutdown:
+			return ErrShutdown
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// awaitConn waits while the client is connecting, connecting it first if it
+// is Idle. Calls are made once it returns nil, the failures to connect are
+// reported by them.
+func (c *Client) awaitConn(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c.mutex.Lock()
+		if c.state == Idle && c.dial != nil && !c.closing {
+			c.setStateLocked(Connecting)
+			go c.reconnect()
+		}
+		state, changed := c.state, c.stateChanged
+		c.mutex.Unlock()
+		if state != Connecting {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (c *Client) setStateLocked(state ConnectivityState) {
+	if c.state == state {
+		return
+	}
+	c.state = state
+	close(c.stateChanged)
+	c.stateChanged = make(chan struct{})
+}
+
+// reconnect redials until it gets a connection or the client is closed,
+// backing off after every failed attempt.
+func (c *Client) reconnect() {
+	if !c.redial() {
+		c.backoff()
+	}
+}
+
+// backoff redials after a wait until it gets a connection or the client is
+// closed, the wait grows with every failed attempt.
+func (c *Client) backoff() {
+	for retries := 0; ; retries++ {
+		timer := time.NewTimer(c.options.backoff.delay(retries))
+		select {
+		case <-timer.C:
+		case <-c.done:
+			timer.Stop()
+			return
+		}
+		if c.redial() {
+			return
+		}
+	}
+}
+
+// redial makes one attempt to connect, a failed one leaves the client in
+// TransientFailure. It reports whether there is no need to try again, as the
+// client got a connection or was closed.
+func (c *Client) redial() bool {
+	c.mutex.Lock()
+	if c.closing {
+		c.mutex.Unlock()
+		return true
+	}
+	c.setStateLocked(Connecting)
+	c.mutex.Unlock()
+
+	conn, err := c.dial()
+	if err == nil {
+		if err = c.connect(conn); err == nil {
+			return true
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closing {
+		return true
+	}
+	c.err = status.Errorf(codes.Unavailable, "tinyrpc: connection failed: %v", err)
+	c.setStateLocked(TransientFailure)
+	return false
+}
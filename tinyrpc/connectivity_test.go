@@ -0,0 +1,146 @@
+package tinyrpc
+
+import (
+	"context"
+	"github.com/braver-braver/tinyrpc/codec"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/braver-braver/tinyrpc/serializer"
+	"github.com/braver-braver/tinyrpc/status"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+var testBackoff = BackoffConfig{
+	BaseDelay:  10 * time.Millisecond,
+	Multiplier: 1.6,
+	Jitter:     0.2,
+	MaxDelay:   50 * time.Millisecond,
+}
+
+func TestBackoffConfig_Delay(t *testing.T) {
+	b := BackoffConfig{BaseDelay: time.Second, Multiplier: 2, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		retries int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 5 * time.Second},
+		{100, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, b.delay(tt.retries), "retries %d", tt.retries)
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.delay(1)
+		assert.GreaterOrEqual(t, d, time.Second)
+		assert.LessOrEqual(t, d, 3*time.Second)
+	}
+}
+
+func TestDial_Reconnect(t *testing.T) {
+	arith := &Arith{deadlines: make(chan time.Time, 1)}
+	s, addr, _ := startServer(t, arith)
+	client, err := Dial(addr, WithBackoff(testBackoff))
+	assert.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, Ready, client.State())
+
+	// the server goes away with a call in flight
+	call := client.Go(context.Background(), "Arith.Wait", &message.ArithRequest{}, &message.ArithResponse{}, nil)
+	<-arith.deadlines
+	assert.NoError(t, s.Close())
+	assert.Equal(t, codes.Unavailable, status.Code((<-call.Done).Error))
+
+	// the client keeps redialing meanwhile
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, client.WaitForReady(ctx), context.DeadlineExceeded)
+	assert.Contains(t, []ConnectivityState{Connecting, TransientFailure}, client.State())
+	err = client.Call("Arith.Add", &message.ArithRequest{}, &message.ArithResponse{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	// until the server is back
+	lis, err := net.Listen("tcp", addr)
+	assert.NoError(t, err)
+	s = NewServer()
+	assert.NoError(t, s.Register(&Arith{}))
+	go s.Serve(lis)
+	defer s.Close()
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, client.WaitForReady(ctx))
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+	assert.Equal(t, float64(3), reply.C)
+
+	assert.NoError(t, client.Close())
+	assert.Equal(t, Shutdown, client.State())
+	assert.ErrorIs(t, client.WaitForReady(ctx), ErrShutdown)
+}
+
+func TestDial_ServerDown(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := lis.Addr().String()
+	assert.NoError(t, lis.Close())
+
+	// the first attempt fails, the client redials in the background
+	client, err := Dial(addr, WithBackoff(testBackoff))
+	assert.NoError(t, err)
+	defer client.Close()
+	assert.Contains(t, []ConnectivityState{Connecting, TransientFailure}, client.State())
+	err = client.Call("Arith.Add", &message.ArithRequest{}, &message.ArithResponse{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	lis, err = net.Listen("tcp", addr)
+	assert.NoError(t, err)
+	s := NewServer()
+	assert.NoError(t, s.Register(&Arith{}))
+	go s.Serve(lis)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, client.WaitForReady(ctx))
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+	assert.Equal(t, float64(3), reply.C)
+
+	// the connection is lost, closing the client doesn't report it
+	assert.NoError(t, s.Close())
+	assert.True(t, client.WaitForStateChange(ctx, Ready))
+	assert.NoError(t, client.Close())
+
+	_, err = Dial(addr, WithSerializer(&serializer.ProtoSerializer{}))
+	assert.ErrorIs(t, err, codec.NotFoundSerializerError)
+}
+
+func TestDial_Idle(t *testing.T) {
+	s, addr, _ := startServer(t, &Arith{})
+	defer s.Close()
+	client, err := Dial(addr, WithIdleTimeout(30*time.Millisecond))
+	assert.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.True(t, client.WaitForStateChange(ctx, Ready))
+	assert.Equal(t, Idle, client.State())
+
+	// the next call connects again
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+	assert.Equal(t, float64(3), reply.C)
+	assert.Equal(t, Ready, client.State())
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, client.WaitForStateChange(ctx, Ready))
+}
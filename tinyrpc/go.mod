@@ -3,13 +3,17 @@ module github.com/braver-braver/tinyrpc
 go 1.20
 
 require (
+	github.com/cespare/xxhash/v2 v2.2.0
 	github.com/klauspost/compress v1.16.5
+	github.com/pierrec/lz4/v4 v4.1.21
 	github.com/stretchr/testify v1.8.3
+	github.com/vmihailenco/msgpack/v5 v5.3.5
 	google.golang.org/protobuf v1.30.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,20 @@
+package tinyrpc
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// handshakeTimeout bounds how long a peer may take to complete the handshake.
+const handshakeTimeout = 10 * time.Second
+
+// handshake runs fn, which negotiates the connection parameters, with a
+// deadline on conn if it supports deadlines.
+func handshake(conn io.ReadWriteCloser, fn func() error) error {
+	if nc, ok := conn.(net.Conn); ok {
+		_ = nc.SetDeadline(time.Now().Add(handshakeTimeout))
+		defer nc.SetDeadline(time.Time{})
+	}
+	return fn()
+}
@@ -0,0 +1,204 @@
+package header
+
+import (
+	"encoding/binary"
+	"github.com/braver-braver/tinyrpc/checksum"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/serializer"
+	"math"
+)
+
+// The extension area closes both headers. It holds optional fields as
+// tag-length-value entries:
+// +---------+---------+-------+---------+---------+-------+-----+
+// |   Len   |   Tag   |  Len  |  Value  |   Tag   |  Len  | ... |
+// +---------+---------+-------+---------+---------+-------+-----+
+// | uvarint | uvarint |uvarint|  bytes  | uvarint |uvarint| ... |
+// +---------+---------+-------+---------+---------+-------+-----+
+// New header fields are added as new tags, so that peers which don't know
+// a tag can skip it instead of misparsing the header.
+
+// maxExtensionsSize is the room the extensions of a header take at most, it
+// lets the area be built on the stack.
+const maxExtensionsSize = 32
+
+// extension tags, 0 is reserved.
+const (
+	tagSerializeType uint64 = iota + 1
+	tagChecksumType
+	tagCode
+	tagDetails
+	tagFrameType
+	tagWindow
+	tagChecksumHigh
+)
+
+// appendExtension appends a tag-length-value entry to ext.
+func appendExtension(ext []byte, tag uint64, value []byte) []byte {
+	ext = binary.AppendUvarint(ext, tag)
+	ext = binary.AppendUvarint(ext, uint64(len(value)))
+	return append(ext, value...)
+}
+
+// appendExtensions appends the extension area built by appendExtension.
+func appendExtensions(dst []byte, ext []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(ext)))
+	return append(dst, ext...)
+}
+
+// readExtensions walks the extension area and calls set for every entry. set
+// returns false if it knows the tag but can't decode the value. It returns
+// the size of the area, or a size <= 0 when data is malformed.
+func readExtensions(data []byte, set func(tag uint64, value []byte) bool) int {
+	length, idx := binary.Uvarint(data)
+	if idx <= 0 || length > uint64(len(data)-idx) {
+		return 0
+	}
+	ext := data[idx : idx+int(length)]
+	for len(ext) > 0 {
+		tag, n := binary.Uvarint(ext)
+		if n <= 0 {
+			return 0
+		}
+		ext = ext[n:]
+		size, n := binary.Uvarint(ext)
+		if n <= 0 || size > uint64(len(ext)-n) {
+			return 0
+		}
+		ext = ext[n:]
+		if !set(tag, ext[:size]) {
+			return 0
+		}
+		ext = ext[size:]
+	}
+	return idx + int(length)
+}
+
+func appendSerializeType(ext []byte, t serializer.SerializeType) []byte {
+	if t == serializer.Proto {
+		return ext
+	}
+	return appendExtension(ext, tagSerializeType, binary.LittleEndian.AppendUint16(nil, uint16(t)))
+}
+
+func readSerializeType(value []byte, t *serializer.SerializeType) bool {
+	if len(value) != Uint16Size {
+		return false
+	}
+	*t = serializer.SerializeType(binary.LittleEndian.Uint16(value))
+	return true
+}
+
+func appendChecksumType(ext []byte, t checksum.Type) []byte {
+	if t == checksum.IEEE {
+		return ext
+	}
+	return appendExtension(ext, tagChecksumType, binary.LittleEndian.AppendUint16(nil, uint16(t)))
+}
+
+func readChecksumType(value []byte, t *checksum.Type) bool {
+	if len(value) != Uint16Size {
+		return false
+	}
+	*t = checksum.Type(binary.LittleEndian.Uint16(value))
+	return true
+}
+
+// appendChecksumHigh appends the high half of a 64-bit checksum, the fixed
+// field of the header holds the low one.
+func appendChecksumHigh(ext []byte, sum uint64) []byte {
+	if sum>>32 == 0 {
+		return ext
+	}
+	return appendExtension(ext, tagChecksumHigh, binary.LittleEndian.AppendUint32(nil, uint32(sum>>32)))
+}
+
+func readChecksumHigh(value []byte, sum *uint64) bool {
+	if len(value) != Uint32Size {
+		return false
+	}
+	*sum |= uint64(binary.LittleEndian.Uint32(value)) << 32
+	return true
+}
+
+func appendCode(ext []byte, c codes.Code) []byte {
+	if c == codes.OK {
+		return ext
+	}
+	return appendExtension(ext, tagCode, binary.LittleEndian.AppendUint16(nil, uint16(c)))
+}
+
+func readCode(value []byte, c *codes.Code) bool {
+	if len(value) != Uint16Size {
+		return false
+	}
+	*c = codes.Code(binary.LittleEndian.Uint16(value))
+	return true
+}
+
+// appendDetails appends the details as an entry of length-prefixed values.
+func appendDetails(ext []byte, details [][]byte) []byte {
+	if len(details) == 0 {
+		return ext
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	size := 0
+	for _, d := range details {
+		size += binary.PutUvarint(prefix[:], uint64(len(d))) + len(d)
+	}
+	ext = binary.AppendUvarint(ext, tagDetails)
+	ext = binary.AppendUvarint(ext, uint64(size))
+	for _, d := range details {
+		ext = binary.AppendUvarint(ext, uint64(len(d)))
+		ext = append(ext, d...)
+	}
+	return ext
+}
+
+// readDetails decodes the entry written by appendDetails. The details are
+// copied, as value is part of a buffer that gets reused.
+func readDetails(value []byte, details *[][]byte) bool {
+	for len(value) > 0 {
+		size, n := binary.Uvarint(value)
+		if n <= 0 || size > uint64(len(value)-n) {
+			return false
+		}
+		value = value[n:]
+		*details = append(*details, append([]byte(nil), value[:size]...))
+		value = value[size:]
+	}
+	return true
+}
+
+func appendFrameType(ext []byte, t FrameType) []byte {
+	if t == FrameUnary {
+		return ext
+	}
+	return appendExtension(ext, tagFrameType, []byte{byte(t)})
+}
+
+func readFrameType(value []byte, t *FrameType) bool {
+	if len(value) != 1 {
+		return false
+	}
+	*t = FrameType(value[0])
+	return true
+}
+
+func appendWindow(ext []byte, window uint32) []byte {
+	if window == 0 {
+		return ext
+	}
+	var value [binary.MaxVarintLen32]byte
+	n := binary.PutUvarint(value[:], uint64(window))
+	return appendExtension(ext, tagWindow, value[:n])
+}
+
+func readWindow(value []byte, window *uint32) bool {
+	w, n := binary.Uvarint(value)
+	if n != len(value) || w > math.MaxUint32 {
+		return false
+	}
+	*window = uint32(w)
+	return true
+}
@@ -0,0 +1,121 @@
+package header
+
+import (
+	"github.com/braver-braver/tinyrpc/checksum"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/serializer"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReadExtensions(t *testing.T) {
+	type entry struct {
+		tag   uint64
+		value []byte
+	}
+	cases := []struct {
+		name    string
+		data    []byte
+		entries []entry
+		size    int
+	}{
+		{
+			"empty",
+			[]byte{0x0},
+			nil,
+			1,
+		},
+		{
+			"entries",
+			[]byte{0x7, 0x1, 0x2, 0xa, 0xb, 0x2, 0x1, 0xc, 0xff},
+			[]entry{{1, []byte{0xa, 0xb}}, {2, []byte{0xc}}},
+			8,
+		},
+		{
+			"truncated area",
+			[]byte{0x7, 0x1, 0x2, 0xa},
+			nil,
+			0,
+		},
+		{
+			"truncated value",
+			[]byte{0x3, 0x1, 0x2, 0xa},
+			nil,
+			0,
+		},
+		{
+			"missing",
+			nil,
+			nil,
+			0,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var entries []entry
+			size := readExtensions(c.data, func(tag uint64, value []byte) bool {
+				entries = append(entries, entry{tag, value})
+				return true
+			})
+			assert.Equal(t, c.size, size)
+			if size > 0 {
+				assert.Equal(t, c.entries, entries)
+			}
+		})
+	}
+}
+
+func TestAppendExtension(t *testing.T) {
+	var ext []byte
+	ext = appendExtension(ext, 1, []byte{0xa, 0xb})
+	ext = appendExtension(ext, 2, []byte{0xc})
+	assert.Equal(t, []byte{0x7, 0x1, 0x2, 0xa, 0xb, 0x2, 0x1, 0xc}, appendExtensions(nil, ext))
+}
+
+func TestRequestHeader_UnknownExtension(t *testing.T) {
+	data := (&RequestHeader{Method: "Add", ID: 1}).Marshall()
+	// replace the empty extension area by one with an unknown tag
+	data = append(data[:len(data)-1], 0x4, 0x7f, 0x2, 0x1, 0x2)
+
+	h := &RequestHeader{}
+	assert.NoError(t, h.Unmarshall(data))
+	assert.Equal(t, "Add", h.Method)
+	assert.Equal(t, uint64(1), h.ID)
+}
+
+func TestHeader_Extensions(t *testing.T) {
+	req := &RequestHeader{Method: "Add", ID: 1, SerializeType: 3, ChecksumType: checksum.CRC32C,
+		FrameType: FrameStreamOpen, Window: 1 << 20}
+	h := &RequestHeader{}
+	assert.NoError(t, h.Unmarshall(req.Marshall()))
+	assert.Equal(t, serializer.SerializeType(3), h.SerializeType)
+	assert.Equal(t, checksum.CRC32C, h.ChecksumType)
+	assert.Equal(t, FrameStreamOpen, h.FrameType)
+	assert.Equal(t, uint32(1<<20), h.Window)
+
+	resp := &ResponseHeader{ID: 1, SerializeType: 3, ChecksumType: checksum.None, Error: "denied", Code: codes.PermissionDenied,
+		Details: [][]byte{{0x1, 0x2}, make([]byte, 300)}, FrameType: FrameStreamEnd}
+	rh := &ResponseHeader{}
+	assert.NoError(t, rh.Unmarshall(resp.Marshall()))
+	assert.Equal(t, serializer.SerializeType(3), rh.SerializeType)
+	assert.Equal(t, checksum.None, rh.ChecksumType)
+	assert.Equal(t, codes.PermissionDenied, rh.Code)
+	assert.Equal(t, resp.Details, rh.Details)
+	assert.Equal(t, FrameStreamEnd, rh.FrameType)
+
+	// a 64-bit checksum keeps its high half
+	req = &RequestHeader{Method: "Add", ID: 1, ChecksumType: checksum.XXHash64, Checksum: 0x8cb841db40e6ae83}
+	h.ResetHeader()
+	assert.NoError(t, h.Unmarshall(req.Marshall()))
+	assert.Equal(t, uint64(0x8cb841db40e6ae83), h.Checksum)
+	resp = &ResponseHeader{ID: 1, ChecksumType: checksum.XXHash64, Checksum: 0x8cb841db40e6ae83}
+	rh.ResetHeader()
+	assert.NoError(t, rh.Unmarshall(resp.Marshall()))
+	assert.Equal(t, uint64(0x8cb841db40e6ae83), rh.Checksum)
+
+	// the value of a known tag must have the right size
+	data := (&RequestHeader{Method: "Add", ID: 1}).Marshall()
+	data = append(data[:len(data)-1], 0x3, 0x1, 0x1, 0x3)
+	assert.ErrorIs(t, h.Unmarshall(data), UnmarshalError)
+}
@@ -0,0 +1,59 @@
+package header
+
+// FrameType tells what a frame carries. It is FrameUnary for the requests
+// and responses of unary calls, which leave it out of the header.
+type FrameType uint8
+
+const (
+	// FrameUnary is the request or the response of a unary call.
+	FrameUnary FrameType = iota
+	// FrameStreamOpen opens a stream to Method. The ID of the frame names
+	// the stream from then on, its Window grants the server credits.
+	FrameStreamOpen
+	// FrameStreamMessage carries a message of a stream.
+	FrameStreamMessage
+	// FrameHalfClose tells the server the client sends no more messages on
+	// the stream.
+	FrameHalfClose
+	// FrameStreamEnd ends a stream with the status and the trailer of the
+	// server.
+	FrameStreamEnd
+	// FrameWindowUpdate grants the peer Window more messages on the stream.
+	FrameWindowUpdate
+	// FrameOneWay is the request of a one-way call, which is not answered.
+	FrameOneWay
+	// FrameCancel tells the server the client gave up on the call or the
+	// stream ID.
+	FrameCancel
+	// FramePing asks the peer, client or server, for a FramePong to make sure
+	// it is alive.
+	FramePing
+	// FramePong answers a FramePing.
+	FramePong
+)
+
+func (t FrameType) String() string {
+	switch t {
+	case FrameUnary:
+		return "unary"
+	case FrameStreamOpen:
+		return "stream-open"
+	case FrameStreamMessage:
+		return "stream-message"
+	case FrameHalfClose:
+		return "half-close"
+	case FrameStreamEnd:
+		return "stream-end"
+	case FrameWindowUpdate:
+		return "window-update"
+	case FrameOneWay:
+		return "one-way"
+	case FrameCancel:
+		return "cancel"
+	case FramePing:
+		return "ping"
+	case FramePong:
+		return "pong"
+	}
+	return "unknown"
+}
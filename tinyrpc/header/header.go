@@ -3,12 +3,16 @@ package header
 import (
 	"encoding/binary"
 	"errors"
+	"github.com/braver-braver/tinyrpc/checksum"
+	"github.com/braver-braver/tinyrpc/codes"
 	"github.com/braver-braver/tinyrpc/compressor"
+	"github.com/braver-braver/tinyrpc/serializer"
 	"sync"
+	"time"
 )
 
 const (
-	MaxHeaderSize = 2 + 10 + 10 + 10 + 4
+	MaxHeaderSize = 2 + 10 + 10 + 10 + 4 + 10 + 10
 	Uint32Size    = 4
 	Uint16Size    = 2
 )
@@ -16,12 +20,17 @@ const (
 var UnmarshalError = errors.New("an error occurred in Unmarshal")
 
 // RequestHeader request header structure looks like:
-// +--------------+----------------+----------+------------+----------+
-// | CompressType |      Method    |    ID    | RequestLen | Checksum |
-// +--------------+----------------+----------+------------+----------+
-// |    uint16    | uvarint+string |  uvarint |   uvarint  |  uint32  |
-// +--------------+----------------+----------+------------+----------+
+// +--------------+----------------+----------+------------+----------+---------+----------+------------+
+// | CompressType |      Method    |    ID    | RequestLen | Checksum | Timeout | Metadata | Extensions |
+// +--------------+----------------+----------+------------+----------+---------+----------+------------+
+// |    uint16    | uvarint+string |  uvarint |   uvarint  |  uint32  | uvarint | metadata | extensions |
+// +--------------+----------------+----------+------------+----------+---------+----------+------------+
 // for uvarint64, the default num length is 10
+//
+// metadata is encoded as an uvarint count followed by count pairs of
+// uvarint+string key and uvarint+string value.
+//
+// extensions is an uvarint length followed by TLV entries, see extension.go.
 
 type RequestHeader struct {
 	sync.RWMutex
@@ -29,22 +38,49 @@ type RequestHeader struct {
 	Method       string
 	ID           uint64
 	RequestLen   uint32 // ?? 请思考这里为什么使用的是 uint32 来对应 请求头结构的 uvarint
-	Checksum     uint32
+	// Checksum is the checksum of the body, the wire carries its low 32 bits
+	// and an extension the high ones, if any.
+	Checksum uint64
+	// Timeout is the time left until the client's deadline, in nanoseconds.
+	// 发送剩余时间而不是绝对的截止时间，避免受到两端时钟偏差的影响。0 表示没有截止时间。
+	Timeout time.Duration
+	// Metadata carries caller supplied key/value pairs such as auth tokens or
+	// trace IDs.
+	Metadata map[string]string
+	// SerializeType is the serializer of the body, it travels as an extension
+	// and is left out when it is serializer.Proto.
+	SerializeType serializer.SerializeType
+	// ChecksumType is the algorithm of Checksum, it travels as an extension
+	// and is left out when it is checksum.IEEE.
+	ChecksumType checksum.Type
+	// FrameType tells what the frame carries, ID names the stream of the
+	// stream frames.
+	FrameType FrameType
+	// Window is the number of messages granted by FrameStreamOpen and
+	// FrameWindowUpdate frames.
+	Window uint32
 }
 
 func (r *RequestHeader) Marshall() []byte {
+	return r.MarshallAppend(make([]byte, 0, MaxHeaderSize+len(r.Method)+metadataSize(r.Metadata)))
+}
+
+// MarshallAppend appends the encoded header to dst and returns the extended
+// slice, it doesn't allocate if dst is large enough.
+func (r *RequestHeader) MarshallAppend(dst []byte) []byte {
 	r.RLock()
 	defer r.RUnlock()
-	idx := 0
-	header := make([]byte, MaxHeaderSize+len(r.Method))
-	binary.LittleEndian.PutUint16(header[idx:], uint16(r.CompressType))
-	idx += Uint16Size
-	idx += writeString(header[idx:], r.Method)
-	idx += binary.PutUvarint(header[idx:], r.ID)
-	idx += binary.PutUvarint(header[idx:], uint64(r.RequestLen))
-	binary.LittleEndian.PutUint32(header[idx:], r.Checksum)
-	idx += Uint32Size
-	return header[:idx]
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(r.CompressType))
+	dst = appendString(dst, r.Method)
+	dst = binary.AppendUvarint(dst, r.ID)
+	dst = binary.AppendUvarint(dst, uint64(r.RequestLen))
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(r.Checksum))
+	dst = binary.AppendUvarint(dst, uint64(r.Timeout))
+	dst = appendMetadata(dst, r.Metadata)
+	var ext [maxExtensionsSize]byte
+	e := appendChecksumType(appendSerializeType(ext[:0], r.SerializeType), r.ChecksumType)
+	e = appendChecksumHigh(e, r.Checksum)
+	return appendExtensions(dst, appendWindow(appendFrameType(e, r.FrameType), r.Window))
 }
 
 // Unmarshall decode byte slice into RequestHeader structure
@@ -73,10 +109,45 @@ func (r *RequestHeader) Unmarshall(data []byte) (err error) {
 	r.RequestLen = uint32(requestLen)
 	idx += size
 
-	r.Checksum = binary.LittleEndian.Uint32(data[idx:])
+	r.Checksum = uint64(binary.LittleEndian.Uint32(data[idx:]))
+	idx += Uint32Size
+
+	timeout, size := binary.Uvarint(data[idx:])
+	if size <= 0 {
+		return UnmarshalError
+	}
+	r.Timeout = time.Duration(timeout)
+	idx += size
+
+	r.Metadata, size = readMetadata(data[idx:])
+	if size <= 0 {
+		return UnmarshalError
+	}
+	idx += size
+
+	if size = readExtensions(data[idx:], r.setExtension); size <= 0 {
+		return UnmarshalError
+	}
 	return
 }
 
+// setExtension decodes a known extension entry, unknown tags are skipped.
+func (r *RequestHeader) setExtension(tag uint64, value []byte) bool {
+	switch tag {
+	case tagSerializeType:
+		return readSerializeType(value, &r.SerializeType)
+	case tagChecksumType:
+		return readChecksumType(value, &r.ChecksumType)
+	case tagChecksumHigh:
+		return readChecksumHigh(value, &r.Checksum)
+	case tagFrameType:
+		return readFrameType(value, &r.FrameType)
+	case tagWindow:
+		return readWindow(value, &r.Window)
+	}
+	return true
+}
+
 func (r *RequestHeader) GetCompressType() compressor.CompressType {
 	r.RLock()
 	defer r.RUnlock()
@@ -91,14 +162,20 @@ func (r *RequestHeader) ResetHeader() {
 	r.Method = ""
 	r.RequestLen = 0
 	r.Checksum = 0
+	r.Timeout = 0
+	r.Metadata = nil
+	r.SerializeType = 0
+	r.ChecksumType = 0
+	r.FrameType = 0
+	r.Window = 0
 }
 
 // ResponseHeader request header structure looks like:
-// +--------------+---------+----------------+-------------+----------+
-// | CompressType |    ID   |      Error     | ResponseLen | Checksum |
-// +--------------+---------+----------------+-------------+----------+
-// |    uint16    | uvarint | uvarint+string |    uvarint  |  uint32  |
-// +--------------+---------+----------------+-------------+----------+
+// +--------------+---------+----------------+-------------+----------+----------+------------+
+// | CompressType |    ID   |      Error     | ResponseLen | Checksum | Metadata | Extensions |
+// +--------------+---------+----------------+-------------+----------+----------+------------+
+// |    uint16    | uvarint | uvarint+string |    uvarint  |  uint32  | metadata | extensions |
+// +--------------+---------+----------------+-------------+----------+----------+------------+
 
 type ResponseHeader struct {
 	sync.RWMutex
@@ -106,27 +183,46 @@ type ResponseHeader struct {
 	ID           uint64
 	Error        string
 	ResponseLen  uint32
-	Checksum     uint32
+	// Checksum is that of RequestHeader.
+	Checksum uint64
+	// Metadata carries the trailer set by the handler, such as server load
+	// hints.
+	Metadata map[string]string
+	// SerializeType is the serializer of the body, see RequestHeader.
+	SerializeType serializer.SerializeType
+	// ChecksumType is the algorithm of Checksum, see RequestHeader.
+	ChecksumType checksum.Type
+	// Code classifies Error. Peers that don't send codes leave it OK, even
+	// along with an Error.
+	Code codes.Code
+	// Details describe Error further, each is a marshalled
+	// google.protobuf.Any.
+	Details [][]byte
+	// FrameType and Window are those of RequestHeader.
+	FrameType FrameType
+	Window    uint32
 }
 
 func (r *ResponseHeader) Marshall() []byte {
+	return r.MarshallAppend(make([]byte, 0, MaxHeaderSize+len(r.Error)+metadataSize(r.Metadata)))
+}
+
+// MarshallAppend appends the encoded header to dst and returns the extended
+// slice, it doesn't allocate if dst is large enough.
+func (r *ResponseHeader) MarshallAppend(dst []byte) []byte {
 	r.RLock()
 	defer r.RUnlock()
-	idx := 0
-	header := make([]byte, MaxHeaderSize+len(r.Error))
-	binary.LittleEndian.PutUint16(header[idx:], uint16(r.CompressType))
-	idx += Uint16Size
-
-	idx += binary.PutUvarint(header[idx:], r.ID)
-
-	idx += writeString(header[idx:], r.Error)
-
-	idx += binary.PutUvarint(header[idx:], uint64(r.ResponseLen))
-
-	binary.LittleEndian.PutUint32(header[idx:], r.Checksum)
-	idx += Uint32Size
-
-	return header[:idx]
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(r.CompressType))
+	dst = binary.AppendUvarint(dst, r.ID)
+	dst = appendString(dst, r.Error)
+	dst = binary.AppendUvarint(dst, uint64(r.ResponseLen))
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(r.Checksum))
+	dst = appendMetadata(dst, r.Metadata)
+	var ext [maxExtensionsSize]byte
+	e := appendCode(appendChecksumType(appendSerializeType(ext[:0], r.SerializeType), r.ChecksumType), r.Code)
+	e = appendChecksumHigh(e, r.Checksum)
+	e = appendWindow(appendFrameType(e, r.FrameType), r.Window)
+	return appendExtensions(dst, appendDetails(e, r.Details))
 }
 
 func (r *ResponseHeader) Unmarshall(data []byte) (err error) {
@@ -154,10 +250,42 @@ func (r *ResponseHeader) Unmarshall(data []byte) (err error) {
 	r.ResponseLen = uint32(responseLen)
 	idx += size
 
-	r.Checksum = binary.LittleEndian.Uint32(data[idx:])
+	r.Checksum = uint64(binary.LittleEndian.Uint32(data[idx:]))
+	idx += Uint32Size
+
+	r.Metadata, size = readMetadata(data[idx:])
+	if size <= 0 {
+		return UnmarshalError
+	}
+	idx += size
+
+	if size = readExtensions(data[idx:], r.setExtension); size <= 0 {
+		return UnmarshalError
+	}
 	return
 }
 
+// setExtension decodes a known extension entry, unknown tags are skipped.
+func (r *ResponseHeader) setExtension(tag uint64, value []byte) bool {
+	switch tag {
+	case tagSerializeType:
+		return readSerializeType(value, &r.SerializeType)
+	case tagChecksumType:
+		return readChecksumType(value, &r.ChecksumType)
+	case tagChecksumHigh:
+		return readChecksumHigh(value, &r.Checksum)
+	case tagCode:
+		return readCode(value, &r.Code)
+	case tagDetails:
+		return readDetails(value, &r.Details)
+	case tagFrameType:
+		return readFrameType(value, &r.FrameType)
+	case tagWindow:
+		return readWindow(value, &r.Window)
+	}
+	return true
+}
+
 // GetCompressType get compress type
 func (r *ResponseHeader) GetCompressType() compressor.CompressType {
 	r.RLock()
@@ -174,15 +302,18 @@ func (r *ResponseHeader) ResetHeader() {
 	r.CompressType = 0
 	r.Checksum = 0
 	r.ResponseLen = 0
+	r.Metadata = nil
+	r.SerializeType = 0
+	r.ChecksumType = 0
+	r.Code = 0
+	r.Details = nil
+	r.FrameType = 0
+	r.Window = 0
 }
 
-func writeString(data []byte, str string) int {
-	idx := 0
-	idx += binary.PutUvarint(data[idx:], uint64(len(str)))
-	// that equals copy(data[idx:], str)
-	// idx += len(str)
-	idx += copy(data[idx:], str)
-	return idx
+func appendString(dst []byte, str string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(str)))
+	return append(dst, str...)
 }
 
 func readString(data []byte) (string, int) {
@@ -192,3 +323,43 @@ func readString(data []byte) (string, int) {
 	str := string(data[idx : idx+int(length)])
 	return str, idx + len(str)
 }
+
+// metadataSize returns the max number of bytes appendMetadata needs for md.
+func metadataSize(md map[string]string) int {
+	size := binary.MaxVarintLen64
+	for k, v := range md {
+		size += 2*binary.MaxVarintLen64 + len(k) + len(v)
+	}
+	return size
+}
+
+func appendMetadata(dst []byte, md map[string]string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(md)))
+	for k, v := range md {
+		dst = appendString(dst, k)
+		dst = appendString(dst, v)
+	}
+	return dst
+}
+
+// readMetadata decodes the metadata written by appendMetadata, it returns a nil
+// map when there is no pair and a size <= 0 when data is malformed.
+func readMetadata(data []byte) (map[string]string, int) {
+	count, idx := binary.Uvarint(data)
+	// every pair takes at least 2 bytes, reject counts that can't fit.
+	if idx <= 0 || count > uint64(len(data)-idx)/2 {
+		return nil, 0
+	}
+	if count == 0 {
+		return nil, idx
+	}
+	md := make(map[string]string, count)
+	for i := uint64(0); i < count; i++ {
+		k, size := readString(data[idx:])
+		idx += size
+		v, size := readString(data[idx:])
+		idx += size
+		md[k] = v
+	}
+	return md, idx
+}
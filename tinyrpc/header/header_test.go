@@ -5,6 +5,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestRequestHeader_Marshall(t *testing.T) {
@@ -14,10 +15,13 @@ func TestRequestHeader_Marshall(t *testing.T) {
 		ID:           12455,
 		RequestLen:   266,
 		Checksum:     3845236589,
+		Timeout:      time.Second,
+		Metadata:     map[string]string{"k": "v"},
 	}
 
 	assert.Equal(t, []byte{0x0, 0x0, 0x3, 0x41, 0x64, 0x64,
-		0xa7, 0x61, 0x8a, 0x2, 0x6d, 0xa7, 0x31, 0xe5}, header.Marshall())
+		0xa7, 0x61, 0x8a, 0x2, 0x6d, 0xa7, 0x31, 0xe5,
+		0x80, 0x94, 0xeb, 0xdc, 0x3, 0x1, 0x1, 0x6b, 0x1, 0x76, 0x0}, header.Marshall())
 }
 
 func TestRequestHeader_Unmarshall(t *testing.T) {
@@ -33,13 +37,16 @@ func TestRequestHeader_Unmarshall(t *testing.T) {
 		{
 			"test-1",
 			[]byte{0x0, 0x0, 0x3, 0x41, 0x64, 0x64,
-				0xa7, 0x61, 0x8a, 0x2, 0x6d, 0xa7, 0x31, 0xe5},
+				0xa7, 0x61, 0x8a, 0x2, 0x6d, 0xa7, 0x31, 0xe5,
+				0x80, 0x94, 0xeb, 0xdc, 0x3, 0x1, 0x1, 0x6b, 0x1, 0x76, 0x0},
 			expect{&RequestHeader{
 				CompressType: 0,
 				Method:       "Add",
 				ID:           12455,
 				RequestLen:   266,
 				Checksum:     3845236589,
+				Timeout:      time.Second,
+				Metadata:     map[string]string{"k": "v"},
 			}, nil},
 		},
 		{
@@ -55,6 +62,31 @@ func TestRequestHeader_Unmarshall(t *testing.T) {
 			[]byte{0x0},
 			expect{&RequestHeader{}, UnmarshalError},
 		},
+		{
+			"test-4",
+			[]byte{0x0, 0x0, 0x3, 0x41, 0x64, 0x64,
+				0xa7, 0x61, 0x8a, 0x2, 0x6d, 0xa7, 0x31, 0xe5},
+			expect{&RequestHeader{
+				CompressType: 0,
+				Method:       "Add",
+				ID:           12455,
+				RequestLen:   266,
+				Checksum:     3845236589,
+			}, UnmarshalError},
+		},
+		{
+			"test-5",
+			[]byte{0x0, 0x0, 0x3, 0x41, 0x64, 0x64,
+				0xa7, 0x61, 0x8a, 0x2, 0x6d, 0xa7, 0x31, 0xe5,
+				0x0, 0xff, 0xff, 0xff, 0xff, 0xf},
+			expect{&RequestHeader{
+				CompressType: 0,
+				Method:       "Add",
+				ID:           12455,
+				RequestLen:   266,
+				Checksum:     3845236589,
+			}, UnmarshalError},
+		},
 	}
 
 	for _, c := range cases {
@@ -74,6 +106,8 @@ func TestRequestHeader_ResetHeader(t *testing.T) {
 		ID:           12455,
 		RequestLen:   266,
 		Checksum:     3845236589,
+		Timeout:      time.Second,
+		Metadata:     map[string]string{"k": "v"},
 	}
 	header.ResetHeader()
 	assert.Equal(t, true, reflect.DeepEqual(header, &RequestHeader{}))
@@ -86,9 +120,11 @@ func TestResponseHeader_Marshall(t *testing.T) {
 		ID:           12455,
 		ResponseLen:  266,
 		Checksum:     3845236589,
+		Metadata:     map[string]string{"k": "v"},
 	}
 	assert.Equal(t, []byte{0x0, 0x0, 0xa7, 0x61, 0x5, 0x65, 0x72,
-		0x72, 0x6f, 0x72, 0x8a, 0x2, 0x6d, 0xa7, 0x31, 0xe5}, header.Marshall())
+		0x72, 0x6f, 0x72, 0x8a, 0x2, 0x6d, 0xa7, 0x31, 0xe5,
+		0x1, 0x1, 0x6b, 0x1, 0x76, 0x0}, header.Marshall())
 }
 
 func TestResponseHeader_Unmarshall(t *testing.T) {
@@ -106,6 +142,7 @@ func TestResponseHeader_Unmarshall(t *testing.T) {
 			[]byte{
 				0x0, 0x0, 0xa7, 0x61, 0x5, 0x65, 0x72,
 				0x72, 0x6f, 0x72, 0x8a, 0x2, 0x6d, 0xa7, 0x31, 0xe5,
+				0x1, 0x1, 0x6b, 0x1, 0x76, 0x0,
 			},
 			expect{
 				&ResponseHeader{
@@ -114,6 +151,7 @@ func TestResponseHeader_Unmarshall(t *testing.T) {
 					ID:           12455,
 					ResponseLen:  266,
 					Checksum:     3845236589,
+					Metadata:     map[string]string{"k": "v"},
 				}, nil,
 			},
 		},
@@ -152,6 +190,7 @@ func TestResponseHeader_ResetHeader(t *testing.T) {
 		ID:           12455,
 		ResponseLen:  266,
 		Checksum:     3845236589,
+		Metadata:     map[string]string{"k": "v"},
 	}
 	header.ResetHeader()
 	assert.Equal(t, true, reflect.DeepEqual(header, &ResponseHeader{}))
@@ -180,3 +219,34 @@ func TestResponseHeader_GetCompressType(t *testing.T) {
 
 	assert.Equal(t, true, reflect.DeepEqual(compressor.CompressType(0), header.GetCompressType()))
 }
+
+func TestMarshallAppend(t *testing.T) {
+	req := &RequestHeader{Method: "Arith.Add", ID: 7, RequestLen: 18, Timeout: time.Second,
+		Metadata: map[string]string{"k": "v"}, SerializeType: 1}
+	prefix := []byte{0xca, 0xfe}
+	assert.Equal(t, append(prefix, req.Marshall()...), req.MarshallAppend([]byte{0xca, 0xfe}))
+
+	resp := &ResponseHeader{ID: 7, Error: "boom", ResponseLen: 3, Metadata: map[string]string{"k": "v"}}
+	assert.Equal(t, append(prefix, resp.Marshall()...), resp.MarshallAppend([]byte{0xca, 0xfe}))
+}
+
+func BenchmarkRequestHeader_MarshallAppend(b *testing.B) {
+	h := &RequestHeader{Method: "Arith.Add", ID: 7, RequestLen: 18, Timeout: time.Second,
+		Metadata: map[string]string{"trace-id": "0af7651916cd43dd8448eb211c80319c"}, SerializeType: 1}
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf = h.MarshallAppend(buf[:0])
+	}
+}
+
+func BenchmarkRequestHeader_Unmarshall(b *testing.B) {
+	data := (&RequestHeader{Method: "Arith.Add", ID: 7, RequestLen: 18, Timeout: time.Second}).Marshall()
+	h := &RequestHeader{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := h.Unmarshall(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -10,12 +10,12 @@ var (
 func init() {
 	RequestPool = sync.Pool{
 		New: func() interface{} {
-			return RequestHeader{}
+			return &RequestHeader{}
 		},
 	}
 	ResponsePool = sync.Pool{
 		New: func() interface{} {
-			return ResponseHeader{}
+			return &ResponseHeader{}
 		},
 	}
 }
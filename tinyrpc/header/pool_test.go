@@ -0,0 +1,34 @@
+package header
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRequestPool(t *testing.T) {
+	h, ok := RequestPool.Get().(*RequestHeader)
+	assert.True(t, ok)
+	assert.Equal(t, &RequestHeader{}, h)
+
+	h.Method = "Arith.Add"
+	h.ID = 1
+	h.ResetHeader()
+	RequestPool.Put(h)
+	h, ok = RequestPool.Get().(*RequestHeader)
+	assert.True(t, ok)
+	assert.Equal(t, &RequestHeader{}, h)
+}
+
+func TestResponsePool(t *testing.T) {
+	h, ok := ResponsePool.Get().(*ResponseHeader)
+	assert.True(t, ok)
+	assert.Equal(t, &ResponseHeader{}, h)
+
+	h.Error = "error"
+	h.ID = 1
+	h.ResetHeader()
+	ResponsePool.Put(h)
+	h, ok = ResponsePool.Get().(*ResponseHeader)
+	assert.True(t, ok)
+	assert.Equal(t, &ResponseHeader{}, h)
+}
@@ -0,0 +1,45 @@
+package tinyrpc
+
+import "context"
+
+// UnaryInvoker continues a unary call. On the client it sends the request and
+// waits for the reply, on the server it runs the registered method.
+type UnaryInvoker func(ctx context.Context, serviceMethod string, args, reply any) error
+
+// UnaryInterceptor intercepts the execution of a unary call, e.g. for logging,
+// auth or metrics. It has to call invoker to continue the call and may inspect
+// the reply and the returned error afterwards. The metadata of the call is
+// available from ctx: metadata.FromOutgoingContext on the client and
+// metadata.FromIncomingContext on the server.
+type UnaryInterceptor func(ctx context.Context, serviceMethod string, args, reply any, invoker UnaryInvoker) error
+
+// WithUnaryInterceptor adds interceptors to a server or a client. Interceptors
+// run in the order they are added, the first one being the outermost.
+func WithUnaryInterceptor(interceptors ...UnaryInterceptor) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+// chainUnaryInterceptors folds interceptors into a single one, it returns nil
+// when there is nothing to chain.
+func chainUnaryInterceptors(interceptors []UnaryInterceptor) UnaryInterceptor {
+	switch len(interceptors) {
+	case 0:
+		return nil
+	case 1:
+		return interceptors[0]
+	}
+	return func(ctx context.Context, serviceMethod string, args, reply any, invoker UnaryInvoker) error {
+		return interceptors[0](ctx, serviceMethod, args, reply, chainedInvoker(interceptors, 0, invoker))
+	}
+}
+
+func chainedInvoker(interceptors []UnaryInterceptor, curr int, final UnaryInvoker) UnaryInvoker {
+	if curr == len(interceptors)-1 {
+		return final
+	}
+	return func(ctx context.Context, serviceMethod string, args, reply any) error {
+		return interceptors[curr+1](ctx, serviceMethod, args, reply, chainedInvoker(interceptors, curr+1, final))
+	}
+}
@@ -0,0 +1,94 @@
+package tinyrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/metadata"
+	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/braver-braver/tinyrpc/status"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// recorder returns an interceptor that appends what it sees to events.
+func recorder(name string, events *[]string) UnaryInterceptor {
+	return func(ctx context.Context, serviceMethod string, args, reply any, invoker UnaryInvoker) error {
+		*events = append(*events, name+" before "+serviceMethod)
+		err := invoker(ctx, serviceMethod, args, reply)
+		*events = append(*events, name+" after "+serviceMethod)
+		return err
+	}
+}
+
+func TestChainUnaryInterceptors(t *testing.T) {
+	assert.Nil(t, chainUnaryInterceptors(nil))
+
+	var events []string
+	chain := chainUnaryInterceptors([]UnaryInterceptor{
+		recorder("first", &events),
+		recorder("second", &events),
+		recorder("third", &events),
+	})
+	err := chain(context.Background(), "Arith.Add", nil, nil,
+		func(ctx context.Context, serviceMethod string, args, reply any) error {
+			events = append(events, "invoke "+serviceMethod)
+			return errors.New("failed")
+		})
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, []string{
+		"first before Arith.Add",
+		"second before Arith.Add",
+		"third before Arith.Add",
+		"invoke Arith.Add",
+		"third after Arith.Add",
+		"second after Arith.Add",
+		"first after Arith.Add",
+	}, events)
+}
+
+func TestUnaryInterceptor(t *testing.T) {
+	var serverEvents []string
+	s, addr, _ := startServer(t, &Arith{},
+		WithUnaryInterceptor(recorder("server", &serverEvents)),
+		WithUnaryInterceptor(func(ctx context.Context, serviceMethod string, args, reply any, invoker UnaryInvoker) error {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if md["token"] != "secret" {
+				return errors.New("unauthenticated")
+			}
+			err := invoker(ctx, serviceMethod, args, reply)
+			reply.(*message.ArithResponse).C *= 10
+			return err
+		}),
+	)
+	defer s.Close()
+
+	var clientEvents []string
+	client := dialClient(t, addr,
+		WithUnaryInterceptor(recorder("client", &clientEvents)),
+		WithUnaryInterceptor(func(ctx context.Context, serviceMethod string, args, reply any, invoker UnaryInvoker) error {
+			ctx = metadata.AppendToOutgoingContext(ctx, "token", "secret")
+			return invoker(ctx, serviceMethod, args, reply)
+		}),
+	)
+	defer client.Close()
+
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+	assert.Equal(t, float64(30), reply.C)
+	assert.Equal(t, []string{"client before Arith.Add", "client after Arith.Add"}, clientEvents)
+	assert.Equal(t, []string{"server before Arith.Add", "server after Arith.Add"}, serverEvents)
+
+	// interceptors also run around asynchronous calls, and the trailer is
+	// still delivered.
+	call := <-client.Go(context.Background(), "Arith.Echo", &message.ArithRequest{}, reply, nil).Done
+	assert.NoError(t, call.Error)
+	assert.Equal(t, metadata.MD{"token": "secret", "load": "0.5"}, call.Trailer)
+	assert.Len(t, clientEvents, 4)
+
+	// the server interceptor rejects calls without the token
+	plain := dialClient(t, addr)
+	defer plain.Close()
+	err := plain.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply)
+	assert.Equal(t, status.Error(codes.Unknown, "unauthenticated"), err)
+}
@@ -0,0 +1,55 @@
+// Package bufpool pools the byte slices used to encode and decode frames, so
+// that a call doesn't allocate them afresh.
+package bufpool
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	minClass = 8  // 256 B, the smallest pooled buffer
+	maxClass = 20 // 1 MiB, larger buffers are left to the GC
+)
+
+// pools holds a pool per power of two size class, so that a small frame
+// doesn't pin a large buffer and a large one doesn't grow a small buffer.
+var pools [maxClass - minClass + 1]sync.Pool
+
+// Get returns a buffer of length 0 and capacity >= size. Hand it back with
+// Put once its content is not used anymore.
+func Get(size int) *[]byte {
+	class := classOf(size)
+	if class > maxClass {
+		b := make([]byte, 0, size)
+		return &b
+	}
+	if b, ok := pools[class-minClass].Get().(*[]byte); ok {
+		*b = (*b)[:0]
+		return b
+	}
+	b := make([]byte, 0, 1<<class)
+	return &b
+}
+
+// Put returns a buffer obtained from Get to its pool. The buffer may have
+// grown by appends, it is filed by its current capacity.
+func Put(b *[]byte) {
+	c := cap(*b)
+	if c < 1<<minClass {
+		return
+	}
+	// the class of which the buffer is large enough for every Get.
+	class := bits.Len(uint(c)) - 1
+	if class > maxClass {
+		return
+	}
+	pools[class-minClass].Put(b)
+}
+
+func classOf(size int) int {
+	if size <= 1<<minClass {
+		return minClass
+	}
+	return bits.Len(uint(size - 1))
+}
@@ -0,0 +1,47 @@
+package bufpool
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	cases := []struct {
+		name string
+		size int
+		cap  int
+	}{
+		{"zero", 0, 256},
+		{"smallest class", 256, 256},
+		{"rounded up", 257, 512},
+		{"largest class", 1 << 20, 1 << 20},
+		{"not pooled", 1<<20 + 1, 1<<20 + 1},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := Get(c.size)
+			assert.Len(t, *b, 0)
+			assert.Equal(t, c.cap, cap(*b))
+			Put(b)
+		})
+	}
+}
+
+func TestPut(t *testing.T) {
+	// a buffer grown by appends must only serve sizes it can hold
+	b := make([]byte, 0, 700)
+	Put(&b)
+	for i := 0; i < 10; i++ {
+		assert.GreaterOrEqual(t, cap(*Get(512)), 512)
+		assert.GreaterOrEqual(t, cap(*Get(1024)), 1024)
+	}
+}
+
+func BenchmarkGetPut(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := Get(4 << 10)
+		*buf = append(*buf, "frame"...)
+		Put(buf)
+	}
+}
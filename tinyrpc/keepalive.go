@@ -0,0 +1,147 @@
+package tinyrpc
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultKeepaliveTimeout is how long a ping waits for the peer when
+	// WithKeepalive is given no timeout.
+	DefaultKeepaliveTimeout = 20 * time.Second
+	// DefaultKeepaliveMinInterval is the default shortest interval a server
+	// lets clients ping it at.
+	DefaultKeepaliveMinInterval = 5 * time.Second
+	// maxPingStrikes is how many pings a client may send too early before
+	// the server hangs up.
+	maxPingStrikes = 2
+)
+
+var (
+	errKeepaliveTimeout = errors.New("tinyrpc: keepalive timeout")
+	errIdleTimeout      = errors.New("tinyrpc: idle timeout")
+	errTooManyPings     = errors.New("tinyrpc: too many pings")
+)
+
+// WithKeepalive makes a client or server ping its peer once nothing was read
+// from it for interval, and close the connection if the peer stays silent
+// for timeout after the ping. The calls in flight then fail with
+// codes.Unavailable right away, instead of hanging on a dead peer. Clients
+// should not ping more often than the server allows, see
+// WithKeepaliveMinInterval.
+func WithKeepalive(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		o.keepaliveInterval = interval
+		o.keepaliveTimeout = timeout
+	}
+}
+
+// WithIdleTimeout makes a client or server close its connections once they
+// have no calls in flight and nothing was read from them for d.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// WithKeepaliveMinInterval makes a server hang up on clients that ping it
+// more often than every d, which defaults to DefaultKeepaliveMinInterval.
+// d <= 0 lets clients ping at will.
+func WithKeepaliveMinInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.keepaliveMinInterval = d
+	}
+}
+
+// keepalive watches a connection for silence. The reader of the connection
+// reports every frame it reads.
+type keepalive struct {
+	interval time.Duration
+	timeout  time.Duration
+	idle     time.Duration
+	lastRead atomic.Int64 // UnixNano of the last frame read
+}
+
+func newKeepalive(interval, timeout, idle time.Duration) *keepalive {
+	k := &keepalive{interval: interval, timeout: timeout, idle: idle}
+	if k.timeout <= 0 {
+		k.timeout = DefaultKeepaliveTimeout
+	}
+	k.read()
+	return k
+}
+
+// read records that a frame was read.
+func (k *keepalive) read() {
+	k.lastRead.Store(time.Now().UnixNano())
+}
+
+// run pings the peer and closes the connection once it is silent for too
+// long, until done is closed. busy reports whether calls are in flight.
+func (k *keepalive) run(done <-chan struct{}, busy func() bool, ping func() error, close func(reason error)) {
+	if k.interval <= 0 && k.idle <= 0 {
+		return
+	}
+	var pingedAt time.Time
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+		wait := k.check(&pingedAt, busy, ping, close)
+		if wait <= 0 {
+			return
+		}
+		timer.Reset(wait)
+	}
+}
+
+// check pings or closes the connection if it is time to, and returns how
+// long to wait until the next check, 0 once the connection is closed.
+func (k *keepalive) check(pingedAt *time.Time, busy func() bool, ping func() error, close func(error)) time.Duration {
+	now := time.Now()
+	silent := now.Sub(time.Unix(0, k.lastRead.Load()))
+	wait := time.Duration(1<<63 - 1)
+	if k.idle > 0 {
+		wait = k.idle - silent
+		if busy() {
+			wait = k.idle
+		} else if wait <= 0 {
+			close(errIdleTimeout)
+			return 0
+		}
+	}
+	if k.interval <= 0 {
+		return wait
+	}
+	next := k.interval - silent
+	switch {
+	case !pingedAt.IsZero() && silent >= now.Sub(*pingedAt):
+		// nothing was read since the ping
+		if next = k.timeout - now.Sub(*pingedAt); next <= 0 {
+			close(errKeepaliveTimeout)
+			return 0
+		}
+	case next <= 0:
+		if err := ping(); err != nil {
+			// the connection is broken, its reader finds out
+			return 0
+		}
+		*pingedAt = now
+		// look again once the pong may have arrived
+		next = k.timeout
+		if k.interval < next {
+			next = k.interval
+		}
+	default:
+		*pingedAt = time.Time{}
+	}
+	if next < wait {
+		wait = next
+	}
+	return wait
+}
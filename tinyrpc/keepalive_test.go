@@ -0,0 +1,117 @@
+package tinyrpc
+
+import (
+	"context"
+	"github.com/braver-braver/tinyrpc/codec"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/braver-braver/tinyrpc/status"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestKeepalive_Ping(t *testing.T) {
+	tests := []struct {
+		name   string
+		server []Option
+		client []Option
+	}{
+		{"server pings", []Option{WithKeepalive(10*time.Millisecond, 50*time.Millisecond)}, nil},
+		{"client pings", []Option{WithKeepaliveMinInterval(0)}, []Option{WithKeepalive(10*time.Millisecond, 50*time.Millisecond)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, addr, _ := startServer(t, &Arith{}, tt.server...)
+			defer s.Close()
+			client := dialClient(t, addr, tt.client...)
+			defer client.Close()
+
+			// the pings are answered, the connection outlives many timeouts
+			time.Sleep(200 * time.Millisecond)
+			reply := &message.ArithResponse{}
+			assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+			assert.Equal(t, float64(3), reply.C)
+		})
+	}
+}
+
+func TestKeepalive_DeadPeer(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer lis.Close()
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// shake hands, then play dead
+		_, _ = codec.ServerHandshake(conn)
+		time.Sleep(time.Second)
+	}()
+
+	client := dialClient(t, lis.Addr().String(), WithKeepalive(20*time.Millisecond, 50*time.Millisecond))
+	defer client.Close()
+	start := time.Now()
+	err = client.Call("Arith.Add", &message.ArithRequest{}, &message.ArithResponse{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.ErrorContains(t, err, errKeepaliveTimeout.Error())
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	err = client.Call("Arith.Add", &message.ArithRequest{}, &message.ArithResponse{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestKeepalive_IdleTimeout(t *testing.T) {
+	arith := &Arith{deadlines: make(chan time.Time, 1)}
+	s, addr, _ := startServer(t, arith, WithIdleTimeout(50*time.Millisecond))
+	defer s.Close()
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	// a call in flight keeps the connection open
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	err := client.CallContext(ctx, "Arith.Wait", &message.ArithRequest{}, &message.ArithResponse{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	<-arith.deadlines
+
+	// then it is closed once idle
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.conns) == 0
+	}, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		err := client.Call("Arith.Add", &message.ArithRequest{}, &message.ArithResponse{})
+		return status.Code(err) == codes.Unavailable
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestKeepalive_PingsBetweenCalls(t *testing.T) {
+	s, addr, _ := startServer(t, &Arith{}, WithKeepaliveMinInterval(time.Second))
+	defer s.Close()
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	// early pings are forgiven once the server answered something
+	for i := 0; i < 2*maxPingStrikes; i++ {
+		assert.NoError(t, client.ping())
+		reply := &message.ArithResponse{}
+		assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+		assert.Equal(t, float64(3), reply.C)
+	}
+}
+
+func TestKeepalive_TooManyPings(t *testing.T) {
+	arith := &Arith{deadlines: make(chan time.Time, 1)}
+	s, addr, _ := startServer(t, arith)
+	defer s.Close()
+	client := dialClient(t, addr, WithKeepalive(10*time.Millisecond, time.Second))
+	defer client.Close()
+
+	err := client.Call("Arith.Wait", &message.ArithRequest{}, &message.ArithResponse{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
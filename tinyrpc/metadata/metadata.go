@@ -0,0 +1,84 @@
+// Package metadata defines the key/value pairs that travel in the request
+// and response headers of a rpc, e.g. auth tokens, trace IDs or server load
+// hints.
+package metadata
+
+import "context"
+
+// MD is a mapping from metadata keys to values.
+type MD map[string]string
+
+// Pairs returns an MD formed by the mapping of key, value ... Pairs panics if
+// len(kv) is odd.
+func Pairs(kv ...string) MD {
+	if len(kv)%2 == 1 {
+		panic("metadata: Pairs got an odd number of input pairs")
+	}
+	md := make(MD, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		md[kv[i]] = kv[i+1]
+	}
+	return md
+}
+
+// Copy returns a copy of md.
+func (md MD) Copy() MD {
+	if md == nil {
+		return nil
+	}
+	out := make(MD, len(md))
+	for k, v := range md {
+		out[k] = v
+	}
+	return out
+}
+
+// Join merges the given MDs into md, later values win.
+func (md MD) Join(mds ...MD) {
+	for _, m := range mds {
+		for k, v := range m {
+			md[k] = v
+		}
+	}
+}
+
+type (
+	incomingKey struct{}
+	outgoingKey struct{}
+)
+
+// NewOutgoingContext returns a new context with md attached, the client sends
+// it along with every call made with the context.
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, outgoingKey{}, md)
+}
+
+// AppendToOutgoingContext returns a new context with the provided kv pairs
+// merged with any existing outgoing metadata.
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := FromOutgoingContext(ctx)
+	if md == nil {
+		md = MD{}
+	}
+	md.Join(Pairs(kv...))
+	return NewOutgoingContext(ctx, md)
+}
+
+// FromOutgoingContext returns a copy of the outgoing metadata in ctx if it
+// exists.
+func FromOutgoingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(outgoingKey{}).(MD)
+	return md.Copy(), ok
+}
+
+// NewIncomingContext returns a new context with the metadata received from
+// the client attached. It is used by the server, and by tests of handlers.
+func NewIncomingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, incomingKey{}, md)
+}
+
+// FromIncomingContext returns a copy of the metadata the client sent, if any.
+func FromIncomingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(incomingKey{}).(MD)
+	return md.Copy(), ok
+}
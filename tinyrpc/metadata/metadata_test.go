@@ -0,0 +1,40 @@
+package metadata
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPairs(t *testing.T) {
+	assert.Equal(t, MD{"a": "1", "b": "2"}, Pairs("a", "1", "b", "2"))
+	assert.Panics(t, func() { Pairs("a") })
+}
+
+func TestOutgoingContext(t *testing.T) {
+	ctx := context.Background()
+	md, ok := FromOutgoingContext(ctx)
+	assert.False(t, ok)
+	assert.Nil(t, md)
+
+	ctx = NewOutgoingContext(ctx, Pairs("token", "secret"))
+	ctx = AppendToOutgoingContext(ctx, "trace-id", "42")
+	md, ok = FromOutgoingContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, MD{"token": "secret", "trace-id": "42"}, md)
+
+	// the returned metadata is a copy
+	md["token"] = "changed"
+	md, _ = FromOutgoingContext(ctx)
+	assert.Equal(t, "secret", md["token"])
+}
+
+func TestIncomingContext(t *testing.T) {
+	ctx := NewIncomingContext(context.Background(), Pairs("tenant", "acme"))
+	md, ok := FromIncomingContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, MD{"tenant": "acme"}, md)
+
+	_, ok = FromOutgoingContext(ctx)
+	assert.False(t, ok)
+}
@@ -0,0 +1,50 @@
+package tinyrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+)
+
+type peerKey struct{}
+
+// Peer describes the client at the other end of a call.
+type Peer struct {
+	// Addr is the remote address of the connection, nil if the connection
+	// is not a net.Conn.
+	Addr net.Addr
+	// TLS is the state of the TLS connection, nil for plain connections.
+	TLS *tls.ConnectionState
+}
+
+// ClientCertificate returns the certificate the client authenticated with,
+// or nil if it didn't present one that the server verified.
+func (p *Peer) ClientCertificate() *x509.Certificate {
+	if p.TLS == nil || len(p.TLS.VerifiedChains) == 0 || len(p.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return p.TLS.VerifiedChains[0][0]
+}
+
+// PeerFromContext returns the peer of the call ctx belongs to, it is set on
+// the contexts passed to handlers and interceptors.
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
+
+// newPeer describes the client on conn, whose TLS handshake, if any, is
+// complete.
+func newPeer(conn io.ReadWriteCloser) *Peer {
+	p := &Peer{}
+	if nc, ok := conn.(net.Conn); ok {
+		p.Addr = nc.RemoteAddr()
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		p.TLS = &state
+	}
+	return p
+}
@@ -0,0 +1,29 @@
+package serializer
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// GobSerializer encodes any value with encoding/gob. Every message carries
+// its own type information, as no gob stream is shared between calls.
+type GobSerializer struct {
+}
+
+func (_ GobSerializer) Marshal(message interface{}) ([]byte, error) {
+	if message == nil {
+		return []byte{}, nil
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(message); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (_ GobSerializer) UnMarshal(data []byte, message interface{}) error {
+	if message == nil || len(data) == 0 {
+		return nil
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(message)
+}
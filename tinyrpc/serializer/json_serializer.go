@@ -0,0 +1,35 @@
+package serializer
+
+import (
+	"encoding/json"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// JSONSerializer encodes proto messages with protojson, so that field names
+// and well known types follow the proto JSON mapping, and any other value
+// with encoding/json.
+type JSONSerializer struct {
+}
+
+func (_ JSONSerializer) Marshal(message interface{}) ([]byte, error) {
+	if message == nil {
+		return []byte{}, nil
+	}
+	if body, ok := message.(proto.Message); ok {
+		return protojson.Marshal(body)
+	}
+	return json.Marshal(message)
+}
+
+// UnMarshal decodes data into message, an empty data leaves message as is,
+// like it does for ProtoSerializer.
+func (_ JSONSerializer) UnMarshal(data []byte, message interface{}) error {
+	if message == nil || len(data) == 0 {
+		return nil
+	}
+	if body, ok := message.(proto.Message); ok {
+		return protojson.Unmarshal(data, body)
+	}
+	return json.Unmarshal(data, message)
+}
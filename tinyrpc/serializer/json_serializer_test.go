@@ -0,0 +1,59 @@
+package serializer
+
+import (
+	"encoding/json"
+	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+func TestJSONSerializer_RoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		message interface{}
+		empty   interface{}
+	}{
+		{"request", &message.ArithRequest{A: 1, B: 2.5}, &message.ArithRequest{}},
+		{"response", &message.ArithResponse{C: -3}, &message.ArithResponse{}},
+		{"zero message", &message.ArithResponse{}, &message.ArithResponse{}},
+		{"struct", &testStruct{A: 1}, &testStruct{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := JSONSerializer{}.Marshal(c.message)
+			assert.NoError(t, err)
+			assert.True(t, json.Valid(data))
+			assert.NoError(t, JSONSerializer{}.UnMarshal(data, c.empty))
+			if m, ok := c.message.(proto.Message); ok {
+				assert.True(t, proto.Equal(m, c.empty.(proto.Message)))
+			} else {
+				assert.Equal(t, c.message, c.empty)
+			}
+		})
+	}
+}
+
+func TestJSONSerializer_ProtoJSON(t *testing.T) {
+	// proto messages follow the proto JSON mapping, so fields carry the
+	// names of arith.proto.
+	data, err := JSONSerializer{}.Marshal(&message.ArithRequest{A: 1, B: 2})
+	assert.NoError(t, err)
+	var fields map[string]float64
+	assert.NoError(t, json.Unmarshal(data, &fields))
+	assert.Equal(t, map[string]float64{"a": 1, "b": 2}, fields)
+
+	req := &message.ArithRequest{}
+	assert.NoError(t, JSONSerializer{}.UnMarshal([]byte(`{"a": 3, "b": "4"}`), req))
+	assert.True(t, proto.Equal(&message.ArithRequest{A: 3, B: 4}, req))
+	assert.Error(t, JSONSerializer{}.UnMarshal([]byte(`{"c": 1}`), req))
+}
+
+func TestJSONSerializer_Nil(t *testing.T) {
+	data, err := JSONSerializer{}.Marshal(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{}, data)
+	assert.NoError(t, JSONSerializer{}.UnMarshal(nil, nil))
+	assert.NoError(t, JSONSerializer{}.UnMarshal(nil, &message.ArithRequest{}))
+}
@@ -0,0 +1,22 @@
+package serializer
+
+import "github.com/vmihailenco/msgpack/v5"
+
+// MsgPackSerializer encodes any value with MessagePack, plain Go structs
+// don't need a .proto file.
+type MsgPackSerializer struct {
+}
+
+func (_ MsgPackSerializer) Marshal(message interface{}) ([]byte, error) {
+	if message == nil {
+		return []byte{}, nil
+	}
+	return msgpack.Marshal(message)
+}
+
+func (_ MsgPackSerializer) UnMarshal(data []byte, message interface{}) error {
+	if message == nil || len(data) == 0 {
+		return nil
+	}
+	return msgpack.Unmarshal(data, message)
+}
@@ -7,8 +7,6 @@ import (
 
 var NotImplementProtoMessageError = errors.New("param doesn't implement proto.Message")
 
-var Proto = ProtoSerializer{}
-
 type ProtoSerializer struct {
 }
 
@@ -35,3 +33,23 @@ func (_ ProtoSerializer) UnMarshal(data []byte, message interface{}) error {
 	}
 	return proto.Unmarshal(data, body)
 }
+
+// MarshalAppend appends the encoding of message to dst.
+func (_ ProtoSerializer) MarshalAppend(dst []byte, message interface{}) ([]byte, error) {
+	if message == nil {
+		return dst, nil
+	}
+	body, ok := message.(proto.Message)
+	if !ok {
+		return nil, NotImplementProtoMessageError
+	}
+	return proto.MarshalOptions{}.MarshalAppend(dst, body)
+}
+
+// Size returns the encoded size of message, 0 if it isn't a proto.Message.
+func (_ ProtoSerializer) Size(message interface{}) int {
+	if body, ok := message.(proto.Message); ok {
+		return proto.Size(body)
+	}
+	return 0
+}
@@ -1,33 +1,148 @@
 package serializer
 
 import (
-	"testing"
 	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
 )
 
 type testStruct struct {
-
+	A float64
 }
+
 func TestProtoSerializer_Marshal(t *testing.T) {
 	type expect struct {
 		data []byte
-		err error
+		err  error
 	}
-	cases := []struct{
-		name string
-		arg interface{}
+	cases := []struct {
+		name   string
+		arg    interface{}
 		expect expect
 	}{
 		{
 			"test-1",
-			&pb.ArithmeticRequest{
-
-			}
+			&message.ArithRequest{A: 1, B: 2},
+			expect{
+				[]byte{0x9, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xf0, 0x3f,
+					0x11, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x40},
+				nil,
+			},
+		},
+		{
+			"test-2",
+			nil,
+			expect{[]byte{}, nil},
+		},
+		{
+			"test-3",
+			&testStruct{A: 1},
+			expect{nil, NotImplementProtoMessageError},
 		},
 	}
 
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := ProtoSerializer{}.Marshal(c.arg)
+			assert.Equal(t, c.expect.data, data)
+			assert.Equal(t, c.expect.err, err)
+		})
+	}
 }
 
 func TestProtoSerializer_UnMarshal(t *testing.T) {
+	type expect struct {
+		message interface{}
+		err     error
+	}
+	cases := []struct {
+		name    string
+		data    []byte
+		message interface{}
+		expect  expect
+	}{
+		{
+			"test-1",
+			[]byte{0x9, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0xf0, 0x3f,
+				0x11, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x40},
+			&message.ArithRequest{},
+			expect{&message.ArithRequest{A: 1, B: 2}, nil},
+		},
+		{
+			"test-2",
+			nil,
+			nil,
+			expect{nil, nil},
+		},
+		{
+			"test-3",
+			nil,
+			&testStruct{},
+			expect{&testStruct{}, NotImplementProtoMessageError},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ProtoSerializer{}.UnMarshal(c.data, c.message)
+			assert.Equal(t, c.expect.err, err)
+			if m, ok := c.expect.message.(proto.Message); ok {
+				assert.True(t, proto.Equal(m, c.message.(proto.Message)))
+			} else {
+				assert.Equal(t, c.expect.message, c.message)
+			}
+		})
+	}
+}
 
+func TestProtoSerializer_MarshalAppend(t *testing.T) {
+	prefix := []byte{0xca, 0xfe}
+	// one key per level, maps are marshalled in random order
+	nested, err := structpb.NewStruct(map[string]interface{}{
+		"a": map[string]interface{}{"b": []interface{}{1.0, "c"}},
+	})
+	assert.NoError(t, err)
+	cases := []struct {
+		name    string
+		message interface{}
+		err     error
+	}{
+		{"message", &message.ArithRequest{A: 1, B: 2}, nil},
+		{"empty message", &message.ArithRequest{}, nil},
+		{"nested message", nested, nil},
+		{"nil", nil, nil},
+		{"not a message", &testStruct{A: 1}, NotImplementProtoMessageError},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// no Size first, the sizes of nested messages are not cached yet
+			data, err := ProtoSerializer{}.MarshalAppend(append([]byte(nil), prefix...), c.message)
+			assert.Equal(t, c.err, err)
+			if err != nil {
+				return
+			}
+			if m, ok := c.message.(proto.Message); ok {
+				decoded := m.ProtoReflect().New().Interface()
+				assert.NoError(t, ProtoSerializer{}.UnMarshal(data[len(prefix):], decoded))
+				assert.True(t, proto.Equal(m, decoded))
+			}
+			body, _ := ProtoSerializer{}.Marshal(c.message)
+			assert.Equal(t, append(append([]byte(nil), prefix...), body...), data)
+			assert.Equal(t, len(body), ProtoSerializer{}.Size(c.message))
+		})
+	}
+}
+
+func BenchmarkProtoSerializer_MarshalAppend(b *testing.B) {
+	req := &message.ArithRequest{A: 1.5, B: 2.5}
+	buf := make([]byte, 0, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = (ProtoSerializer{}).MarshalAppend(buf[:0], req); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
@@ -1,6 +1,113 @@
 package serializer
 
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+var (
+	NotFoundSerializerError   = errors.New("not found serializer")
+	NilSerializerError        = errors.New("serializer is nil")
+	SerializerRegisteredError = errors.New("serializer type already registered")
+)
+
+// SerializeType names a serializer on the wire. The types are serializers
+// themselves, they encode with the serializer registered for them.
+type SerializeType uint16
+
+const (
+	Proto SerializeType = iota
+	JSON
+	MsgPack
+	Gob
+)
+
+// Serializer encodes the bodies of calls. UnMarshal must not keep data, the
+// codecs reuse it once UnMarshal returns.
 type Serializer interface {
 	Marshal(message interface{}) ([]byte, error)
 	UnMarshal(data []byte, message interface{}) error
 }
+
+// AppendSerializer is implemented by serializers that can encode into a
+// buffer of the caller, the codecs use it with pooled buffers. Size returns
+// the encoded size of message, it is used to pick a large enough buffer.
+type AppendSerializer interface {
+	Serializer
+	MarshalAppend(dst []byte, message interface{}) ([]byte, error)
+	Size(message interface{}) int
+}
+
+// serializers holds the serializers known to this process, keyed by the type
+// that travels in the request and response headers. Use RegisterSerializer to
+// add one.
+var serializers = map[SerializeType]Serializer{
+	Proto:   ProtoSerializer{},
+	JSON:    JSONSerializer{},
+	MsgPack: MsgPackSerializer{},
+	Gob:     GobSerializer{},
+}
+
+// RegisterSerializer makes s available under t, to both clients and servers.
+// It is not safe for concurrent use with running codecs, call it during
+// initialization. It fails if t is taken already.
+func RegisterSerializer(t SerializeType, s Serializer) error {
+	if s == nil {
+		return NilSerializerError
+	}
+	if _, dup := serializers[t]; dup {
+		return fmt.Errorf("%w: %d", SerializerRegisteredError, t)
+	}
+	serializers[t] = s
+	return nil
+}
+
+// Lookup returns the serializer registered for t.
+func Lookup(t SerializeType) (Serializer, bool) {
+	s, ok := serializers[t]
+	return s, ok
+}
+
+// Types returns the registered types in ascending order.
+func Types() []SerializeType {
+	types := make([]SerializeType, 0, len(serializers))
+	for t := range serializers {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// Marshal encodes message with the serializer registered for t.
+func (t SerializeType) Marshal(message interface{}) ([]byte, error) {
+	s, ok := serializers[t]
+	if !ok {
+		return nil, NotFoundSerializerError
+	}
+	return s.Marshal(message)
+}
+
+// UnMarshal decodes data with the serializer registered for t.
+func (t SerializeType) UnMarshal(data []byte, message interface{}) error {
+	s, ok := serializers[t]
+	if !ok {
+		return NotFoundSerializerError
+	}
+	return s.UnMarshal(data, message)
+}
+
+// TypeOf returns the type s travels as, s being either a SerializeType or a
+// serializer of the same type as a registered one.
+func TypeOf(s Serializer) (SerializeType, bool) {
+	if t, ok := s.(SerializeType); ok {
+		return t, true
+	}
+	for t, registered := range serializers {
+		if reflect.TypeOf(registered) == reflect.TypeOf(s) {
+			return t, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,134 @@
+package serializer
+
+import (
+	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"testing"
+)
+
+var serializerNames = map[SerializeType]string{Proto: "proto", JSON: "json", MsgPack: "msgpack", Gob: "gob"}
+
+type plainStruct struct {
+	Name   string
+	Values []int
+	Labels map[string]string
+}
+
+func TestSerializers_RoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		message interface{}
+		empty   interface{}
+	}{
+		{"arith request", &message.ArithRequest{A: 1, B: 2.5}, &message.ArithRequest{}},
+		{"arith response", &message.ArithResponse{C: -3}, &message.ArithResponse{}},
+		{"plain struct", &plainStruct{"add", []int{1, 2}, map[string]string{"k": "v"}}, &plainStruct{}},
+	}
+
+	for _, st := range []SerializeType{MsgPack, Gob} {
+		s, _ := Lookup(st)
+		for _, c := range cases {
+			t.Run(serializerNames[st]+"/"+c.name, func(t *testing.T) {
+				data, err := s.Marshal(c.message)
+				assert.NoError(t, err)
+				assert.NoError(t, s.UnMarshal(data, c.empty))
+				if m, ok := c.message.(proto.Message); ok {
+					assert.True(t, proto.Equal(m, c.empty.(proto.Message)))
+				} else {
+					assert.Equal(t, c.message, c.empty)
+				}
+			})
+		}
+
+		data, err := s.Marshal(nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{}, data)
+		assert.NoError(t, s.UnMarshal(nil, &plainStruct{}))
+		assert.Error(t, s.UnMarshal([]byte{0xc1}, &plainStruct{}))
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	cases := []struct {
+		name       string
+		serializer Serializer
+		want       SerializeType
+		ok         bool
+	}{
+		{"type", JSON, JSON, true},
+		{"unknown type", SerializeType(100), 100, true},
+		{"registered serializer", GobSerializer{}, Gob, true},
+		{"unknown serializer", &ProtoSerializer{}, 0, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			st, ok := TypeOf(c.serializer)
+			assert.Equal(t, c.want, st)
+			assert.Equal(t, c.ok, ok)
+		})
+	}
+
+	data, err := MsgPack.Marshal(&plainStruct{Name: "add"})
+	assert.NoError(t, err)
+	decoded := &plainStruct{}
+	assert.NoError(t, MsgPack.UnMarshal(data, decoded))
+	assert.Equal(t, "add", decoded.Name)
+	_, err = SerializeType(100).Marshal(&plainStruct{})
+	assert.ErrorIs(t, err, NotFoundSerializerError)
+}
+
+// customSerializer is registered by the tests under custom.
+type customSerializer struct {
+	JSONSerializer
+}
+
+const custom SerializeType = 0x100
+
+func TestRegisterSerializer(t *testing.T) {
+	defer delete(serializers, custom)
+
+	assert.ErrorIs(t, RegisterSerializer(custom, nil), NilSerializerError)
+	assert.ErrorIs(t, RegisterSerializer(JSON, customSerializer{}), SerializerRegisteredError)
+	s, ok := Lookup(JSON)
+	assert.True(t, ok)
+	assert.Equal(t, JSONSerializer{}, s)
+
+	assert.NoError(t, RegisterSerializer(custom, customSerializer{}))
+	s, ok = Lookup(custom)
+	assert.True(t, ok)
+	assert.Equal(t, customSerializer{}, s)
+	assert.Equal(t, []SerializeType{Proto, JSON, MsgPack, Gob, custom}, Types())
+	st, ok := TypeOf(customSerializer{})
+	assert.True(t, ok)
+	assert.Equal(t, custom, st)
+	assert.ErrorIs(t, RegisterSerializer(custom, customSerializer{}), SerializerRegisteredError)
+}
+
+func BenchmarkSerializers(b *testing.B) {
+	for _, st := range []SerializeType{Proto, JSON, MsgPack, Gob} {
+		s, _ := Lookup(st)
+		req := &message.ArithRequest{A: 1.5, B: 2.5}
+		data, err := s.Marshal(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(serializerNames[st]+"/Marshal", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Marshal(req); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(serializerNames[st]+"/UnMarshal", func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if err := s.UnMarshal(data, &message.ArithRequest{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,56 +1,829 @@
 package tinyrpc
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/braver-braver/tinyrpc/checksum"
 	"github.com/braver-braver/tinyrpc/codec"
+	"github.com/braver-braver/tinyrpc/codes"
 	"github.com/braver-braver/tinyrpc/compressor"
+	"github.com/braver-braver/tinyrpc/header"
+	"github.com/braver-braver/tinyrpc/metadata"
 	"github.com/braver-braver/tinyrpc/serializer"
+	"github.com/braver-braver/tinyrpc/status"
+	"io"
 	"log"
 	"net"
-	"net/rpc"
+	"reflect"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrServerClosed is returned by Serve after a call to Shutdown or Close.
+var ErrServerClosed = errors.New("tinyrpc: Server closed")
+
+// shutdownPollInterval is how often Shutdown checks for connections that
+// have finished their in-flight calls.
+const shutdownPollInterval = 10 * time.Millisecond
+
+const (
+	// DefaultMaxMessageSize is the default limit of the decompressed size of
+	// the messages a client or server reads.
+	DefaultMaxMessageSize = 4 << 20
+	// DefaultMaxHeaderSize is the default limit of the size of the headers a
+	// client or server reads.
+	DefaultMaxHeaderSize = 64 << 10
+	// DefaultMaxBodySize is the default limit of the size of the bodies a
+	// client or server reads, before decompression.
+	DefaultMaxBodySize = DefaultMaxMessageSize
 )
 
 // Option provides options for rpc
 type Option func(o *options)
 
 type options struct {
-	compressType compressor.CompressType
-	serializer   serializer.Serializer
+	compressType    compressor.CompressType
+	minCompressSize int
+	maxMessageSize  int
+	maxHeaderSize   int
+	maxBodySize     int
+	checksumType    checksum.Type
+	requireChecksum bool
+	serializer      serializer.Serializer
+	interceptors    []UnaryInterceptor
+	tlsConfig       *tls.Config
+	authenticator   Authenticator
+	acl             ACL
+	panicHandler    PanicHandler
+	streamWindow    int
+
+	keepaliveInterval    time.Duration
+	keepaliveTimeout     time.Duration
+	keepaliveMinInterval time.Duration
+	idleTimeout          time.Duration
+	backoff              BackoffConfig
+}
+
+// WithMaxMessageSize limits the decompressed size of the messages read by a
+// client or server, larger ones fail with compressor.MessageTooLargeError
+// instead of being inflated in memory. size <= 0 removes the limit.
+func WithMaxMessageSize(size int) Option {
+	return func(o *options) {
+		o.maxMessageSize = size
+	}
+}
+
+// WithMaxHeaderSize limits the size of the headers read by a client or
+// server. A peer sending a larger one is hung up on. size <= 0 removes the
+// limit.
+func WithMaxHeaderSize(size int) Option {
+	return func(o *options) {
+		o.maxHeaderSize = size
+	}
+}
+
+// WithMaxBodySize limits the size of the bodies read by a client or server,
+// as sent on the wire. A server answers a call with a larger body with an
+// error and then hangs up, as the body is left unread. size <= 0 removes the
+// limit.
+func WithMaxBodySize(size int) Option {
+	return func(o *options) {
+		o.maxBodySize = size
+	}
+}
+
+// WithChecksum sets the algorithm a client checksums its requests with, the
+// server answers with the same one. The default is checksum.IEEE.
+func WithChecksum(t checksum.Type) Option {
+	return func(o *options) {
+		o.checksumType = t
+	}
+}
+
+// WithChecksumRequired makes a client or server refuse messages sent with
+// checksum.None. Messages that carry a checksum are always verified,
+// mismatches are counted by codec.ChecksumMismatches.
+func WithChecksumRequired() Option {
+	return func(o *options) {
+		o.requireChecksum = true
+	}
+}
+
+// PanicHandler is called with the value and the stack trace of a panic in
+// the handler or the interceptors of a call, e.g. to report it to an error
+// tracker. The call fails with codes.Internal.
+type PanicHandler func(ctx context.Context, serviceMethod string, p any, stack []byte)
+
+// WithPanicHandler sets the function a server reports panics to, they are
+// logged either way.
+func WithPanicHandler(h PanicHandler) Option {
+	return func(o *options) {
+		o.panicHandler = h
+	}
+}
+
+// codecOptions returns the codec options shared by clients and servers.
+func (o *options) codecOptions() []codec.Option {
+	return []codec.Option{
+		codec.WithMinCompressLen(o.minCompressSize),
+		codec.WithMaxMessageSize(o.maxMessageSize),
+		codec.WithMaxHeaderSize(o.maxHeaderSize),
+		codec.WithMaxBodySize(o.maxBodySize),
+		codec.WithChecksum(o.checksumType),
+		codec.WithChecksumRequired(o.requireChecksum),
+	}
+}
+
+// defaultOptions returns the options clients and servers start with.
+func defaultOptions() options {
+	return options{
+		compressType:   compressor.Raw,
+		serializer:     serializer.Proto,
+		maxMessageSize: DefaultMaxMessageSize,
+		maxHeaderSize:  DefaultMaxHeaderSize,
+		maxBodySize:    DefaultMaxBodySize,
+		streamWindow:   DefaultStreamWindow,
+
+		keepaliveMinInterval: DefaultKeepaliveMinInterval,
+		backoff:              DefaultBackoffConfig,
+	}
 }
 
 type Server struct {
-	*rpc.Server
-	serializer.Serializer
+	serviceMap    sync.Map // map[string]*service
+	interceptor   UnaryInterceptor
+	authenticator Authenticator
+	acl           ACL
+	panicHandler  PanicHandler
+	streamWindow  int
+	codecOptions  []codec.Option
+
+	keepaliveInterval    time.Duration
+	keepaliveTimeout     time.Duration
+	keepaliveMinInterval time.Duration
+	idleTimeout          time.Duration
+
+	inShutdown atomic.Bool
+	mu         sync.Mutex // protect listeners and conns
+	listeners  map[*net.Listener]struct{}
+	conns      map[*serverConn]struct{}
 }
 
 func NewServer(opts ...Option) *Server {
-	options := options{
-		serializer: serializer.Proto,
-	}
+	options := defaultOptions()
 	for _, opt := range opts {
 		opt(&options)
 	}
 
-	return &Server{&rpc.Server{}, options.serializer}
+	return &Server{
+		interceptor:   chainUnaryInterceptors(options.interceptors),
+		authenticator: options.authenticator,
+		acl:           options.acl,
+		panicHandler:  options.panicHandler,
+		streamWindow:  options.streamWindow,
+		codecOptions:  options.codecOptions(),
+
+		keepaliveInterval:    options.keepaliveInterval,
+		keepaliveTimeout:     options.keepaliveTimeout,
+		keepaliveMinInterval: options.keepaliveMinInterval,
+		idleTimeout:          options.idleTimeout,
+
+		listeners: make(map[*net.Listener]struct{}),
+		conns:     make(map[*serverConn]struct{}),
+	}
 }
 
-// Register register rpc function
+// Register publishes the exported methods of rcvr that look like
+//
+//	func (t *T) Method(ctx context.Context, args *Args, reply *Reply) error
+//
+// The ctx carries the deadline and the metadata of the client and is
+// cancelled when the connection goes away. Methods of the net/rpc form,
+// without ctx, are accepted as well. A method fails the call with a code by
+// returning an error of package status, other errors reach the client with
+// codes.Unknown. Methods taking a *ServerStream serve streams, see
+// ServerStream.
 func (s *Server) Register(rcvr interface{}) error {
-	return s.Server.Register(rcvr)
+	return s.register(rcvr, "", false)
 }
 
 // RegisterName register the rpc function with the specified name
 func (s *Server) RegisterName(name string, rcvr interface{}) error {
-	return s.Server.RegisterName(name, rcvr)
+	return s.register(rcvr, name, true)
+}
+
+func (s *Server) register(rcvr any, name string, useName bool) error {
+	svc, err := newService(rcvr, name, useName)
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+	if _, dup := s.serviceMap.LoadOrStore(svc.name, svc); dup {
+		return errors.New("tinyrpc: service already defined: " + svc.name)
+	}
+	return nil
+}
+
+// lookup finds the service and method for a "Service.Method" name.
+func (s *Server) lookup(serviceMethod string) (*service, *methodType, error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return nil, nil, status.Error(codes.Unimplemented, "tinyrpc: service/method request ill-formed: "+serviceMethod)
+	}
+	svci, ok := s.serviceMap.Load(serviceMethod[:dot])
+	if !ok {
+		return nil, nil, status.Error(codes.Unimplemented, "tinyrpc: can't find service "+serviceMethod)
+	}
+	svc := svci.(*service)
+	mtype := svc.method[serviceMethod[dot+1:]]
+	if mtype == nil {
+		return nil, nil, status.Error(codes.Unimplemented, "tinyrpc: can't find method "+serviceMethod)
+	}
+	return svc, mtype, nil
 }
 
+// Serve accepts connections on the listener and serves each of them in a new
+// goroutine. It always returns a non-nil error; after Shutdown or Close the
+// returned error is ErrServerClosed.
 func (s *Server) Serve(lis net.Listener) error {
+	if !s.trackListener(&lis, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(&lis, false)
+
 	log.Printf("tinyrpc server listening on %s", lis.Addr().String())
 
+	var tempDelay time.Duration // how long to sleep on accept failure
 	for {
 		conn, err := lis.Accept()
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if max := 1 * time.Second; tempDelay > max {
+					tempDelay = max
+				}
+				log.Printf("tinyrpc: accept error: %v; retrying in %v", err, tempDelay)
+				time.Sleep(tempDelay)
+				continue
+			}
+			return err
+		}
+		tempDelay = 0
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeTLS accepts connections on the listener and serves them over TLS with
+// config. To authenticate clients by their certificates, set ClientAuth and
+// ClientCAs in config; handlers find the certificate with PeerFromContext.
+func (s *Server) ServeTLS(lis net.Listener, config *tls.Config) error {
+	return s.Serve(tls.NewListener(lis, config))
+}
+
+// ServeConn runs the server on a single connection and blocks until the
+// client hangs up or the server is shut down. The connection starts with the
+// handshake, clients proposing parameters the server doesn't support are
+// turned away. Each call is answered with the serializer the client used, so
+// clients with different serializers can share a server.
+func (s *Server) ServeConn(conn io.ReadWriteCloser) {
+	c := &serverConn{
+		server:  s,
+		conn:    conn,
+		calls:   make(map[uint64]context.CancelFunc),
+		streams: make(map[uint64]*ServerStream),
+		alive:   newKeepalive(s.keepaliveInterval, s.keepaliveTimeout, s.idleTimeout),
+	}
+	// track the connection before the handshake, so that Close ends it too
+	if !s.trackConn(c, true) {
+		_ = conn.Close()
+		return
+	}
+	defer s.trackConn(c, false)
+
+	var hello *codec.Hello
+	err := handshake(conn, func() error {
+		// complete the TLS handshake first, so that the peer is known
+		if tc, ok := conn.(*tls.Conn); ok {
+			if err := tc.Handshake(); err != nil {
+				return err
+			}
+		}
+		var err error
+		hello, err = codec.ServerHandshake(conn)
+		return err
+	})
+	if err != nil {
+		if !s.shuttingDown() {
+			log.Printf("tinyrpc: handshake failed: %v", err)
+		}
+		_ = conn.Close()
+		return
+	}
+
+	c.ctx, c.cancel = context.WithCancel(context.WithValue(context.Background(), peerKey{}, newPeer(conn)))
+	c.codec = codec.NewServerCodec(conn, append([]codec.Option{codec.WithHello(hello)}, s.codecOptions...)...)
+	go c.alive.run(c.ctx.Done(), func() bool { return c.active.Load() > 0 }, c.ping, c.hangUp)
+	c.serve()
+}
+
+// Shutdown gracefully shuts down the server: it closes all listeners, waits
+// for the in-flight calls of every connection to finish and then closes the
+// connections. If ctx expires first, Shutdown returns the context's error and
+// the remaining connections are left to finish on their own.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+
+	s.mu.Lock()
+	err := s.closeListenersLocked()
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close immediately closes all listeners and connections, dropping any
+// in-flight calls. Use Shutdown to drain them instead.
+func (s *Server) Close() error {
+	s.inShutdown.Store(true)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.closeListenersLocked()
+	for c := range s.conns {
+		c.closed = true
+		_ = c.conn.Close()
+	}
+	return err
+}
+
+func (s *Server) shuttingDown() bool {
+	return s.inShutdown.Load()
+}
+
+func (s *Server) trackListener(lis *net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.listeners[lis] = struct{}{}
+	} else {
+		delete(s.listeners, lis)
+	}
+	return true
+}
+
+func (s *Server) trackConn(c *serverConn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.shuttingDown() {
+			return false
+		}
+		s.conns[c] = struct{}{}
+	} else {
+		delete(s.conns, c)
+	}
+	return true
+}
+
+func (s *Server) closeListenersLocked() error {
+	var err error
+	for lis := range s.listeners {
+		if cerr := (*lis).Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// closeIdleConns closes all connections without in-flight calls and reports
+// whether no connection is left.
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		if !c.closed && c.active.Load() == 0 {
+			c.closed = true
+			_ = c.conn.Close()
+		}
+	}
+	return len(s.conns) == 0
+}
+
+// startRequest marks c busy with a request, unless Shutdown or Close closed
+// it already. Doing so under s.mu keeps closeIdleConns from closing c while
+// the request is being dispatched.
+func (s *Server) startRequest(c *serverConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.active.Add(1)
+	return true
+}
+
+// serverConn serves the calls of a single connection. It counts the in-flight
+// calls, so that Shutdown knows when the connection can be closed safely.
+type serverConn struct {
+	server  *Server
+	conn    io.Closer
+	closed  bool // conn was closed by Shutdown or Close, protected by server.mu
+	codec   codec.ServerCodec
+	sending sync.Mutex // serializes WriteResponse
+	wg      sync.WaitGroup
+	active  atomic.Int64
+
+	mu      sync.Mutex                    // protects calls and streams
+	calls   map[uint64]context.CancelFunc // cancel the calls and streams in flight
+	streams map[uint64]*ServerStream      // open streams
+
+	alive       *keepalive
+	lastPing    time.Time   // when the client last pinged, only touched by serve
+	pingStrikes int         // pings of the client that came too early
+	sent        atomic.Bool // a response or a stream frame was written since the last ping
+
+	// ctx is the parent of every call's context, it is cancelled once the
+	// connection is gone.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (c *serverConn) serve() {
+	// streams can't receive anything once the loop ends
+	endErr := status.Error(codes.Unavailable, "tinyrpc: server is shutting down")
+	for !c.server.shuttingDown() {
+		req := &codec.Request{}
+		if err := c.codec.ReadRequestHeader(req); err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) && !c.server.shuttingDown() {
+				log.Printf("tinyrpc: server cannot decode request: %v", err)
+			}
+			// nobody is left to read the replies of the in-flight calls.
+			c.cancel()
+			endErr = status.Error(codes.Unavailable, "tinyrpc: connection closed")
+			break
+		}
+		c.alive.read()
+		if !c.server.startRequest(c) {
+			break
+		}
+		if req.Type != header.FrameUnary && req.Type != header.FrameOneWay {
+			err := c.streamFrame(req)
+			c.active.Add(-1)
+			if err != nil {
+				c.cancel()
+				endErr = status.Error(codes.Unavailable, "tinyrpc: connection closed")
+				break
+			}
+			continue
+		}
+
+		svc, mtype, err := c.server.lookup(req.ServiceMethod)
+		if err == nil && mtype.stream {
+			err = status.Error(codes.Unimplemented, "tinyrpc: "+req.ServiceMethod+" serves streams")
+		}
+		if err != nil {
+			if err := c.codec.ReadRequestBody(nil); err != nil {
+				if errors.Is(err, codec.BodyTooLargeError) {
+					c.sendResponse(req, nil, status.Error(codes.ResourceExhausted, "tinyrpc: "+err.Error()), nil)
+				} else {
+					c.active.Add(-1)
+				}
+				break
+			}
+			c.sendResponse(req, nil, err, nil)
 			continue
 		}
-		go s.Server.ServeCodec(codec.NewServerCodec(conn, s.Serializer))
+		argv, replyv, argIsValue := mtype.newArgs()
+		if err = c.codec.ReadRequestBody(argv.Interface()); err != nil {
+			code := codes.InvalidArgument
+			if errors.Is(err, codec.BodyTooLargeError) || errors.Is(err, compressor.MessageTooLargeError) {
+				code = codes.ResourceExhausted
+			}
+			c.sendResponse(req, nil, status.Error(code, "tinyrpc: server cannot decode request body: "+err.Error()), nil)
+			if errors.Is(err, codec.BodyTooLargeError) {
+				// the body is left unread, the rest of the stream can't be
+				// made sense of.
+				break
+			}
+			continue
+		}
+		if argIsValue {
+			argv = argv.Elem()
+		}
+
+		ctx, cancel := context.WithCancel(c.ctx)
+		c.track(req.Seq, cancel, nil)
+		c.wg.Add(1)
+		go c.call(ctx, svc, mtype, req, argv, replyv)
+	}
+	c.mu.Lock()
+	for _, ss := range c.streams {
+		ss.closeRecv(endErr)
 	}
+	c.mu.Unlock()
+	// wait for the in-flight calls before closing the codec.
+	c.wg.Wait()
+	c.cancel()
+	_ = c.codec.Close()
+}
+
+// call runs a unary call, ctx is cancelled when the client cancels it.
+func (c *serverConn) call(ctx context.Context, svc *service, mtype *methodType, req *codec.Request, argv, replyv reflect.Value) {
+	defer c.wg.Done()
+	defer c.untrack(req.Seq)
+	if req.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+		defer cancel()
+	}
+	ctx = metadata.NewIncomingContext(ctx, req.Metadata)
+	t := &trailer{}
+	ctx = context.WithValue(ctx, trailerKey{}, t)
+
+	err := c.invoke(ctx, svc, mtype, req, argv, replyv)
+	c.sendResponse(req, replyv.Interface(), err, t.get())
+}
+
+// invoke authorizes the call and runs the interceptors and the handler. A
+// panic in any of them fails the call with codes.Internal instead of
+// crashing the server.
+func (c *serverConn) invoke(ctx context.Context, svc *service, mtype *methodType, req *codec.Request, argv, replyv reflect.Value) (err error) {
+	defer c.recoverPanic(ctx, req.ServiceMethod, &err)
+
+	ctx, err = c.server.authorize(ctx, req.ServiceMethod, req.Metadata)
+	if err != nil {
+		return err
+	}
+	if c.server.interceptor == nil {
+		return svc.call(ctx, mtype, argv, replyv)
+	}
+	return c.server.interceptor(ctx, req.ServiceMethod, argv.Interface(), replyv.Interface(),
+		func(ctx context.Context, _ string, _, _ any) error {
+			return svc.call(ctx, mtype, argv, replyv)
+		})
+}
+
+// recoverPanic, deferred by the goroutines running handlers, turns a panic
+// serving serviceMethod into a codes.Internal error in *err.
+func (c *serverConn) recoverPanic(ctx context.Context, serviceMethod string, err *error) {
+	if p := recover(); p != nil {
+		stack := debug.Stack()
+		log.Printf("tinyrpc: panic serving %s: %v\n%s", serviceMethod, p, stack)
+		if c.server.panicHandler != nil {
+			c.server.panicHandler(ctx, serviceMethod, p, stack)
+		}
+		*err = status.Error(codes.Internal, "tinyrpc: internal error serving "+serviceMethod)
+	}
+}
+
+// sendResponse answers req with reply, or with the status of err if it is
+// not nil.
+func (c *serverConn) sendResponse(req *codec.Request, reply any, err error, md metadata.MD) {
+	resp := statusResponse(req, err, md)
+	if err != nil {
+		reply = nil
+	}
+	err = c.writeFrame(resp, reply)
+	c.active.Add(-1)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("tinyrpc: writing response: %v", err)
+	}
+}
+
+// statusResponse builds the response carrying the status of err and the
+// trailer md.
+func statusResponse(req *codec.Request, err error, md metadata.MD) *codec.Response {
+	st := status.Convert(err)
+	return &codec.Response{
+		ServiceMethod: req.ServiceMethod,
+		Seq:           req.Seq,
+		Error:         st.Message(),
+		Code:          st.Code(),
+		Details:       st.RawDetails(),
+		Metadata:      md,
+	}
+}
+
+// writeFrame writes a response or a frame of a stream.
+func (c *serverConn) writeFrame(resp *codec.Response, msg any) error {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	if resp.Type != header.FramePing && resp.Type != header.FramePong {
+		c.sent.Store(true)
+	}
+	return c.codec.WriteResponse(resp, msg)
+}
+
+// track registers the cancel func of a call or a stream in flight.
+func (c *serverConn) track(seq uint64, cancel context.CancelFunc, ss *ServerStream) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls[seq] = cancel
+	if ss != nil {
+		c.streams[seq] = ss
+	}
+}
+
+// untrack forgets a call or a stream once it ended and releases its context.
+func (c *serverConn) untrack(seq uint64) {
+	c.mu.Lock()
+	cancel := c.calls[seq]
+	delete(c.calls, seq)
+	delete(c.streams, seq)
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// streamFrame handles the frames read by serve other than requests: those
+// of streams, cancellations and keepalives. It returns the errors that break
+// the connection.
+func (c *serverConn) streamFrame(req *codec.Request) error {
+	switch req.Type {
+	case header.FramePing:
+		if err := c.checkPing(); err != nil {
+			c.hangUp(err)
+			return err
+		}
+		// answer from another goroutine, the reader mustn't wait for writes
+		go c.pong(req.Seq)
+		return c.codec.ReadRequestBody(nil)
+	case header.FramePong:
+		return c.codec.ReadRequestBody(nil)
+	case header.FrameStreamOpen:
+		if err := c.codec.ReadRequestBody(nil); err != nil {
+			return err
+		}
+		c.openStream(req)
+		return nil
+	case header.FrameCancel:
+		c.mu.Lock()
+		cancel := c.calls[req.Seq]
+		c.mu.Unlock()
+		if cancel != nil {
+			cancel()
+		}
+		return c.codec.ReadRequestBody(nil)
+	}
+	c.mu.Lock()
+	ss := c.streams[req.Seq]
+	c.mu.Unlock()
+	if ss == nil {
+		// the stream ended already
+		return c.codec.ReadRequestBody(nil)
+	}
+	switch req.Type {
+	case header.FrameStreamMessage:
+		m := &codec.Message{}
+		if err := c.codec.ReadRequestBody(m); err != nil {
+			code := codes.InvalidArgument
+			if errors.Is(err, codec.BodyTooLargeError) || errors.Is(err, compressor.MessageTooLargeError) {
+				code = codes.ResourceExhausted
+			}
+			ss.closeRecv(status.Error(code, "tinyrpc: server cannot decode stream message: "+err.Error()))
+			if errors.Is(err, codec.BodyTooLargeError) {
+				return err
+			}
+			return nil
+		}
+		ss.deliver(m)
+		return nil
+	case header.FrameHalfClose:
+		ss.closeRecv(nil)
+	case header.FrameWindowUpdate:
+		ss.grant(req.Window)
+	}
+	return c.codec.ReadRequestBody(nil)
+}
+
+// openStream starts the handler of the stream req opens, or ends the stream
+// right away if there is no such streaming method.
+func (c *serverConn) openStream(req *codec.Request) {
+	c.active.Add(1)
+	svc, mtype, err := c.server.lookup(req.ServiceMethod)
+	if err == nil && !mtype.stream {
+		err = status.Error(codes.Unimplemented, "tinyrpc: "+req.ServiceMethod+" doesn't serve streams")
+	}
+	if err != nil {
+		c.endStream(req, err, nil)
+		return
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if req.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(c.ctx, req.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(c.ctx)
+	}
+	ctx = metadata.NewIncomingContext(ctx, req.Metadata)
+	t := &trailer{}
+	ctx = context.WithValue(ctx, trailerKey{}, t)
+
+	ss := &ServerStream{}
+	ss.stream = newStream(ctx, c.server.streamWindow, func(typ header.FrameType, window uint32, msg any) error {
+		return c.writeFrame(&codec.Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq, Type: typ, Window: window}, msg)
+	})
+	ss.credits = int(req.Window)
+	c.track(req.Seq, cancel, ss)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		err := c.runStream(svc, mtype, req, ss)
+		c.untrack(req.Seq)
+		ss.finish()
+		c.endStream(req, err, t.get())
+	}()
+}
+
+// runStream authorizes the stream, grants the client its window and runs
+// the handler.
+func (c *serverConn) runStream(svc *service, mtype *methodType, req *codec.Request, ss *ServerStream) (err error) {
+	defer c.recoverPanic(ss.ctx, req.ServiceMethod, &err)
+
+	ctx, err := c.server.authorize(ss.ctx, req.ServiceMethod, req.Metadata)
+	if err != nil {
+		return err
+	}
+	ss.ctx = ctx
+	if err := ss.write(header.FrameWindowUpdate, uint32(ss.window), nil); err != nil {
+		return err
+	}
+	return svc.callStream(mtype, ss)
+}
+
+// endStream ends the stream req opened with the status of err and the
+// trailer md.
+func (c *serverConn) endStream(req *codec.Request, err error, md metadata.MD) {
+	resp := statusResponse(req, err, md)
+	resp.Type = header.FrameStreamEnd
+	err = c.writeFrame(resp, nil)
+	c.active.Add(-1)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("tinyrpc: writing response: %v", err)
+	}
+}
+
+// checkPing counts the pings of the client that come sooner than the server
+// allows, too many of them are refused with errTooManyPings. The count starts
+// over whenever the server sent a response or a stream frame.
+func (c *serverConn) checkPing() error {
+	now := time.Now()
+	if c.sent.Swap(false) {
+		// the server sent something since the last ping, start over
+		c.pingStrikes = 0
+		c.lastPing = now
+		return nil
+	}
+	min := c.server.keepaliveMinInterval
+	if min > 0 && !c.lastPing.IsZero() && now.Sub(c.lastPing) < min {
+		if c.pingStrikes++; c.pingStrikes > maxPingStrikes {
+			return errTooManyPings
+		}
+	}
+	c.lastPing = now
+	return nil
+}
+
+func (c *serverConn) ping() error {
+	return c.writeFrame(&codec.Response{Type: header.FramePing}, nil)
+}
+
+func (c *serverConn) pong(seq uint64) {
+	err := c.writeFrame(&codec.Response{Seq: seq, Type: header.FramePong}, nil)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("tinyrpc: writing pong: %v", err)
+	}
+}
+
+// hangUp closes the connection for reason.
+func (c *serverConn) hangUp(reason error) {
+	log.Printf("tinyrpc: closing connection: %v", reason)
+	_ = c.codec.Close()
 }
@@ -0,0 +1,256 @@
+package tinyrpc
+
+import (
+	"context"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/metadata"
+	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/braver-braver/tinyrpc/status"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type Arith struct {
+	// block, if set, is waited on by Add before replying
+	block chan struct{}
+	// deadlines receives the deadline of every Wait call
+	deadlines chan time.Time
+	// waited, if set, receives the error of every Wait call
+	waited chan error
+}
+
+func (a *Arith) Add(ctx context.Context, args *message.ArithRequest, reply *message.ArithResponse) error {
+	if a.block != nil {
+		<-a.block
+	}
+	reply.C = args.A + args.B
+	return nil
+}
+
+// Mul has the net/rpc signature without a context.
+func (a *Arith) Mul(args *message.ArithRequest, reply *message.ArithResponse) error {
+	reply.C = args.A * args.B
+	return nil
+}
+
+// Div fails with the arguments as detail when dividing by zero.
+func (a *Arith) Div(ctx context.Context, args *message.ArithRequest, reply *message.ArithResponse) error {
+	if args.B == 0 {
+		st, err := status.New(codes.InvalidArgument, "divide by zero").WithDetails(args)
+		if err != nil {
+			return err
+		}
+		return st.Err()
+	}
+	reply.C = args.A / args.B
+	return nil
+}
+
+// Echo echoes the incoming metadata back as trailer.
+func (a *Arith) Echo(ctx context.Context, args *message.ArithRequest, reply *message.ArithResponse) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if err := SetTrailer(ctx, md); err != nil {
+		return err
+	}
+	return SetTrailer(ctx, metadata.Pairs("load", "0.5"))
+}
+
+// Wait blocks until the context of the call is done.
+func (a *Arith) Wait(ctx context.Context, args *message.ArithRequest, reply *message.ArithResponse) error {
+	deadline, _ := ctx.Deadline()
+	a.deadlines <- deadline
+	<-ctx.Done()
+	if a.waited != nil {
+		a.waited <- ctx.Err()
+	}
+	return ctx.Err()
+}
+
+// Faulty panics in its handler.
+type Faulty struct{}
+
+func (Faulty) Panic(ctx context.Context, args *message.ArithRequest, reply *message.ArithResponse) error {
+	var m map[string]int
+	m["boom"]++
+	return nil
+}
+
+func startServer(t *testing.T, rcvr any, opts ...Option) (*Server, string, chan error) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := NewServer(opts...)
+	assert.NoError(t, s.Register(rcvr))
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(lis)
+	}()
+	return s, lis.Addr().String(), served
+}
+
+func dialClient(t *testing.T, addr string, opts ...Option) *Client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	return NewClient(conn, opts...)
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	arith := &Arith{block: make(chan struct{})}
+	s, addr, served := startServer(t, arith)
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	reply := &message.ArithResponse{}
+	done := client.AsyncCall("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply)
+
+	// wait until the call reaches the handler
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for c := range s.conns {
+			if c.active.Load() == 1 {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond)
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown returned before the in-flight call finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(arith.block)
+	call := <-done
+	assert.NoError(t, call.Error)
+	assert.Equal(t, float64(3), reply.C)
+	assert.NoError(t, <-shutdown)
+
+	_, err := net.Dial("tcp", addr)
+	assert.Error(t, err)
+}
+
+func TestServer_ShutdownContextExpired(t *testing.T) {
+	arith := &Arith{block: make(chan struct{})}
+	defer close(arith.block)
+	s, addr, served := startServer(t, arith)
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	client.AsyncCall("Arith.Add", &message.ArithRequest{A: 1, B: 2}, &message.ArithResponse{})
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.conns) == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+}
+
+func TestServer_Close(t *testing.T) {
+	arith := &Arith{block: make(chan struct{})}
+	defer close(arith.block)
+	s, addr, served := startServer(t, arith)
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	done := client.AsyncCall("Arith.Add", &message.ArithRequest{A: 1, B: 2}, &message.ArithResponse{})
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.conns) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, s.Close())
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+	assert.Error(t, (<-done).Error)
+	assert.ErrorIs(t, s.Serve(nil), ErrServerClosed)
+}
+
+func TestServer_CloseDuringHandshake(t *testing.T) {
+	s, addr, served := startServer(t, &Arith{})
+	// a peer that never sends its hello
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.conns) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, s.Close())
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+	// the connection is closed right away, not once the handshake times out
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestServer_Register(t *testing.T) {
+	s := NewServer()
+	assert.NoError(t, s.Register(&Arith{}))
+	assert.Error(t, s.Register(&Arith{}))
+	assert.Error(t, s.Register(Arith{}))
+	assert.NoError(t, s.RegisterName("Calculator", &Arith{}))
+
+	svc, _ := s.serviceMap.Load("Arith")
+	methods := svc.(*service).method
+	assert.Len(t, methods, 5)
+	assert.True(t, methods["Add"].withContext)
+	assert.False(t, methods["Mul"].withContext)
+}
+
+func TestServer_PanicRecovery(t *testing.T) {
+	type report struct {
+		method string
+		p      any
+		stack  string
+	}
+	reports := make(chan report, 2)
+	s, addr, _ := startServer(t, &Arith{},
+		WithPanicHandler(func(ctx context.Context, serviceMethod string, p any, stack []byte) {
+			reports <- report{serviceMethod, p, string(stack)}
+		}),
+		WithUnaryInterceptor(func(ctx context.Context, serviceMethod string, args, reply any, invoker UnaryInvoker) error {
+			if md, _ := metadata.FromIncomingContext(ctx); md["panic"] != "" {
+				panic(md["panic"])
+			}
+			return invoker(ctx, serviceMethod, args, reply)
+		}))
+	defer s.Close()
+	assert.NoError(t, s.Register(Faulty{}))
+	client := dialClient(t, addr)
+	defer client.Close()
+
+	err := client.Call("Faulty.Panic", &message.ArithRequest{}, &message.ArithResponse{})
+	assert.Equal(t, status.Error(codes.Internal, "tinyrpc: internal error serving Faulty.Panic"), err)
+	r := <-reports
+	assert.Equal(t, "Faulty.Panic", r.method)
+	assert.ErrorContains(t, r.p.(error), "nil map")
+	assert.Contains(t, r.stack, "Faulty.Panic")
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "panic", "in interceptor")
+	err = client.CallContext(ctx, "Arith.Add", &message.ArithRequest{}, &message.ArithResponse{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "in interceptor", (<-reports).p)
+
+	// the connection survives the panics
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+	assert.Equal(t, float64(3), reply.C)
+}
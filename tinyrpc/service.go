@@ -0,0 +1,164 @@
+package tinyrpc
+
+import (
+	"context"
+	"errors"
+	"go/token"
+	"reflect"
+)
+
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeOfStream  = reflect.TypeOf((*ServerStream)(nil))
+)
+
+type methodType struct {
+	method    reflect.Method
+	ArgType   reflect.Type
+	ReplyType reflect.Type
+	// withContext reports whether the method takes a context.Context as its
+	// first argument.
+	withContext bool
+	// stream reports whether the method serves a stream, it then takes the
+	// *ServerStream only.
+	stream bool
+}
+
+type service struct {
+	name   string                 // name of service
+	rcvr   reflect.Value          // receiver of methods for the service
+	typ    reflect.Type           // type of the receiver
+	method map[string]*methodType // registered methods
+}
+
+func newService(rcvr any, name string, useName bool) (*service, error) {
+	s := new(service)
+	s.typ = reflect.TypeOf(rcvr)
+	s.rcvr = reflect.ValueOf(rcvr)
+	sname := name
+	if !useName {
+		sname = reflect.Indirect(s.rcvr).Type().Name()
+	}
+	if sname == "" {
+		return nil, errors.New("tinyrpc.Register: no service name for type " + s.typ.String())
+	}
+	if !useName && !token.IsExported(sname) {
+		return nil, errors.New("tinyrpc.Register: type " + sname + " is not exported")
+	}
+	s.name = sname
+
+	s.method = suitableMethods(s.typ)
+	if len(s.method) == 0 {
+		// To help the user, see if a pointer receiver would work.
+		if len(suitableMethods(reflect.PointerTo(s.typ))) != 0 {
+			return nil, errors.New("tinyrpc.Register: type " + sname +
+				" has no exported methods of suitable type (hint: pass a pointer to value of that type)")
+		}
+		return nil, errors.New("tinyrpc.Register: type " + sname + " has no exported methods of suitable type")
+	}
+	return s, nil
+}
+
+// suitableMethods returns the methods of typ that look like
+//
+//	func (t *T) Method(ctx context.Context, args *Args, reply *Reply) error
+//
+// or, without the context, like a net/rpc method, or like
+//
+//	func (t *T) Method(stream *ServerStream) error
+//
+// for the methods serving streams.
+func suitableMethods(typ reflect.Type) map[string]*methodType {
+	methods := make(map[string]*methodType)
+	for m := 0; m < typ.NumMethod(); m++ {
+		method := typ.Method(m)
+		mtype := method.Type
+		if !method.IsExported() {
+			continue
+		}
+		if mtype.NumIn() == 2 && mtype.In(1) == typeOfStream {
+			if mtype.NumOut() == 1 && mtype.Out(0) == typeOfError {
+				methods[method.Name] = &methodType{method: method, stream: true}
+			}
+			continue
+		}
+		// Method needs receiver, optional ctx, *args and *reply.
+		in := 1
+		withContext := mtype.NumIn() == 4 && mtype.In(1) == typeOfContext
+		if withContext {
+			in++
+		} else if mtype.NumIn() != 3 {
+			continue
+		}
+		argType := mtype.In(in)
+		if !isExportedOrBuiltinType(argType) {
+			continue
+		}
+		replyType := mtype.In(in + 1)
+		if replyType.Kind() != reflect.Pointer || !isExportedOrBuiltinType(replyType) {
+			continue
+		}
+		if mtype.NumOut() != 1 || mtype.Out(0) != typeOfError {
+			continue
+		}
+		methods[method.Name] = &methodType{
+			method:      method,
+			ArgType:     argType,
+			ReplyType:   replyType,
+			withContext: withContext,
+		}
+	}
+	return methods
+}
+
+// isExportedOrBuiltinType reports whether t is an exported or builtin type
+func isExportedOrBuiltinType(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	// PkgPath will be non-empty even for an exported type,
+	// so we need to check the type name as well.
+	return token.IsExported(t.Name()) || t.PkgPath() == ""
+}
+
+// newArgs allocates the argument and reply values for a call of m. The
+// returned argv is a pointer, argIsValue reports whether it has to be
+// dereferenced before calling the method.
+func (m *methodType) newArgs() (argv, replyv reflect.Value, argIsValue bool) {
+	if m.ArgType.Kind() == reflect.Pointer {
+		argv = reflect.New(m.ArgType.Elem())
+	} else {
+		argv = reflect.New(m.ArgType)
+		argIsValue = true
+	}
+
+	replyv = reflect.New(m.ReplyType.Elem())
+	switch m.ReplyType.Elem().Kind() {
+	case reflect.Map:
+		replyv.Elem().Set(reflect.MakeMap(m.ReplyType.Elem()))
+	case reflect.Slice:
+		replyv.Elem().Set(reflect.MakeSlice(m.ReplyType.Elem(), 0, 0))
+	}
+	return
+}
+
+// call invokes the method and returns the error it reported.
+func (s *service) call(ctx context.Context, m *methodType, argv, replyv reflect.Value) error {
+	in := []reflect.Value{s.rcvr, argv, replyv}
+	if m.withContext {
+		in = []reflect.Value{s.rcvr, reflect.ValueOf(ctx), argv, replyv}
+	}
+	if err := m.method.Func.Call(in)[0].Interface(); err != nil {
+		return err.(error)
+	}
+	return nil
+}
+
+// callStream invokes the streaming method and returns the error it reported.
+func (s *service) callStream(m *methodType, ss *ServerStream) error {
+	if err := m.method.Func.Call([]reflect.Value{s.rcvr, reflect.ValueOf(ss)})[0].Interface(); err != nil {
+		return err.(error)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+// Package status defines the status a failed call carries back to the
+// client: a code, a message and optional details. Handlers return a status
+// with Error or Errorf, clients get it back with FromError or Code.
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/braver-braver/tinyrpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Status is the outcome of a call. A nil *Status is OK.
+type Status struct {
+	code    codes.Code
+	message string
+	details [][]byte // marshalled google.protobuf.Any
+}
+
+// New returns a Status with code c and message msg.
+func New(c codes.Code, msg string) *Status {
+	return &Status{code: c, message: msg}
+}
+
+// Newf returns New(c, fmt.Sprintf(format, a...)).
+func Newf(c codes.Code, format string, a ...any) *Status {
+	return New(c, fmt.Sprintf(format, a...))
+}
+
+// Error returns an error for code c and message msg, nil if c is OK.
+func Error(c codes.Code, msg string) error {
+	return New(c, msg).Err()
+}
+
+// Errorf returns Error(c, fmt.Sprintf(format, a...)).
+func Errorf(c codes.Code, format string, a ...any) error {
+	return Error(c, fmt.Sprintf(format, a...))
+}
+
+// FromRaw returns a Status with the details as carried in a response
+// header, each a marshalled google.protobuf.Any.
+func FromRaw(c codes.Code, msg string, details [][]byte) *Status {
+	return &Status{code: c, message: msg, details: details}
+}
+
+// Code returns the code of s.
+func (s *Status) Code() codes.Code {
+	if s == nil {
+		return codes.OK
+	}
+	return s.code
+}
+
+// Message returns the message of s.
+func (s *Status) Message() string {
+	if s == nil {
+		return ""
+	}
+	return s.message
+}
+
+// Err returns an error carrying s, nil if s is OK.
+func (s *Status) Err() error {
+	if s.Code() == codes.OK {
+		return nil
+	}
+	return &CallError{s: s}
+}
+
+// WithDetails returns a copy of s with details appended. Details can't be
+// attached to an OK status.
+func (s *Status) WithDetails(details ...proto.Message) (*Status, error) {
+	if s.Code() == codes.OK {
+		return nil, errors.New("status: no details can be attached to an OK status")
+	}
+	out := &Status{code: s.code, message: s.message, details: append([][]byte(nil), s.details...)}
+	for _, d := range details {
+		a, err := anypb.New(d)
+		if err != nil {
+			return nil, err
+		}
+		b, err := proto.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		out.details = append(out.details, b)
+	}
+	return out, nil
+}
+
+// Details returns the details of s. A detail whose type is not linked into
+// the program, or that can't be decoded, is returned as an error.
+func (s *Status) Details() []any {
+	if s == nil || len(s.details) == 0 {
+		return nil
+	}
+	details := make([]any, 0, len(s.details))
+	for _, b := range s.details {
+		a := &anypb.Any{}
+		if err := proto.Unmarshal(b, a); err != nil {
+			details = append(details, err)
+			continue
+		}
+		m, err := a.UnmarshalNew()
+		if err != nil {
+			details = append(details, err)
+			continue
+		}
+		details = append(details, m)
+	}
+	return details
+}
+
+// RawDetails returns the details of s as carried in a response header.
+func (s *Status) RawDetails() [][]byte {
+	if s == nil {
+		return nil
+	}
+	return s.details
+}
+
+// CallError is the error of a call that failed with a status. Use errors.As
+// to get it, or errors.Is with an error of the same code, e.g.
+//
+//	errors.Is(err, status.Error(codes.NotFound, ""))
+//
+// Errors with codes.DeadlineExceeded and codes.Canceled also match
+// context.DeadlineExceeded and context.Canceled.
+type CallError struct {
+	s *Status
+}
+
+func (e *CallError) Error() string {
+	if e.s.message == "" {
+		return "tinyrpc: " + e.s.code.String()
+	}
+	return e.s.message
+}
+
+// Status returns the status of e.
+func (e *CallError) Status() *Status {
+	return e.s
+}
+
+// Is reports whether target is a *CallError with the same code, or the
+// context error matching the code.
+func (e *CallError) Is(target error) bool {
+	switch {
+	case e.s.code == codes.DeadlineExceeded && target == context.DeadlineExceeded:
+		return true
+	case e.s.code == codes.Canceled && target == context.Canceled:
+		return true
+	}
+	t, ok := target.(*CallError)
+	return ok && t.s.code == e.s.code
+}
+
+// FromError returns the status carried by err, or one with codes.Unknown
+// and false if there is none. The message is that of err, so that the
+// context a *CallError was wrapped in is kept. A nil err is OK.
+func FromError(err error) (*Status, bool) {
+	if err == nil {
+		return nil, true
+	}
+	var se *CallError
+	if !errors.As(err, &se) {
+		return New(codes.Unknown, err.Error()), false
+	}
+	if error(se) == err {
+		return se.s, true
+	}
+	return &Status{code: se.s.code, message: err.Error(), details: se.s.details}, true
+}
+
+// Convert is like FromError, but gives context errors the codes
+// codes.DeadlineExceeded and codes.Canceled.
+func Convert(err error) *Status {
+	s, ok := FromError(err)
+	if ok {
+		return s
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return New(codes.Canceled, err.Error())
+	}
+	return s
+}
+
+// Code returns the code of err, see Convert.
+func Code(err error) codes.Code {
+	return Convert(err).Code()
+}
@@ -0,0 +1,67 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		code codes.Code
+		msg  string
+	}{
+		{"nil", nil, codes.OK, ""},
+		{"plain", errors.New("boom"), codes.Unknown, "boom"},
+		{"status", Error(codes.NotFound, "no such key"), codes.NotFound, "no such key"},
+		{"wrapped", fmt.Errorf("get: %w", Error(codes.NotFound, "no such key")), codes.NotFound, "get: no such key"},
+		{"deadline", fmt.Errorf("wait: %w", context.DeadlineExceeded), codes.DeadlineExceeded, "wait: context deadline exceeded"},
+		{"canceled", context.Canceled, codes.Canceled, "context canceled"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := Convert(c.err)
+			assert.Equal(t, c.code, s.Code())
+			assert.Equal(t, c.msg, s.Message())
+			assert.Equal(t, c.code, Code(c.err))
+		})
+	}
+}
+
+func TestCallError_Is(t *testing.T) {
+	err := fmt.Errorf("call: %w", Error(codes.DeadlineExceeded, "too slow"))
+	assert.ErrorIs(t, err, Error(codes.DeadlineExceeded, ""))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NotErrorIs(t, err, context.Canceled)
+	assert.NotErrorIs(t, err, Error(codes.Canceled, "too slow"))
+
+	assert.Nil(t, Error(codes.OK, "fine"))
+	assert.EqualError(t, Error(codes.Internal, ""), "tinyrpc: Internal")
+}
+
+func TestStatus_Details(t *testing.T) {
+	_, err := New(codes.OK, "").WithDetails(durationpb.New(1))
+	assert.Error(t, err)
+
+	s, err := New(codes.ResourceExhausted, "slow down").WithDetails(durationpb.New(3e9))
+	assert.NoError(t, err)
+	s = FromRaw(s.Code(), s.Message(), s.RawDetails())
+	details := s.Details()
+	if assert.Len(t, details, 1) {
+		assert.True(t, proto.Equal(durationpb.New(3e9), details[0].(proto.Message)))
+	}
+
+	s = FromRaw(codes.Internal, "", [][]byte{{0xff}})
+	details = s.Details()
+	if assert.Len(t, details, 1) {
+		assert.Implements(t, (*error)(nil), details[0])
+	}
+}
@@ -0,0 +1,254 @@
+package tinyrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/braver-braver/tinyrpc/codec"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/header"
+	"github.com/braver-braver/tinyrpc/metadata"
+	"github.com/braver-braver/tinyrpc/status"
+	"io"
+	"sync"
+)
+
+// DefaultStreamWindow is the default number of messages a peer may send on a
+// stream ahead of the receiver reading them.
+const DefaultStreamWindow = 32
+
+// errSendClosed is returned by Send after CloseSend.
+var errSendClosed = errors.New("tinyrpc: send on closed stream")
+
+// errWindowExceeded fails a stream whose peer sent more messages than it
+// was granted.
+var errWindowExceeded = status.Error(codes.ResourceExhausted, "tinyrpc: stream window exceeded")
+
+// WithStreamWindow sets the number of messages a client or server buffers
+// per stream. The peer is granted as many, and more as they are read, so
+// that a slow reader holds back the sender of a stream without stalling the
+// other calls of the connection.
+func WithStreamWindow(n int) Option {
+	return func(o *options) {
+		o.streamWindow = n
+	}
+}
+
+// stream is the state shared by both ends of a stream. Messages are read by
+// the connection, kept undecoded until Recv asks for them, and sent once the
+// peer granted credits for them.
+type stream struct {
+	ctx    context.Context
+	window int
+	// write sends a frame of the stream.
+	write func(typ header.FrameType, window uint32, msg any) error
+
+	recv       chan *codec.Message // closed when the peer sends no more
+	recvErr    error               // why recv is closed, nil for io.EOF
+	recvClosed bool                // only touched by the reader of the connection
+	consumed   int                 // messages read since the last window update
+
+	mu       sync.Mutex // protects following
+	credits  int
+	trailer  metadata.MD
+	more     chan struct{} // signalled when credits are granted
+	done     chan struct{} // closed when no more messages can be sent
+	doneOnce sync.Once
+}
+
+func newStream(ctx context.Context, window int, write func(header.FrameType, uint32, any) error) *stream {
+	if window <= 0 {
+		window = DefaultStreamWindow
+	}
+	return &stream{
+		ctx:    ctx,
+		window: window,
+		write:  write,
+		recv:   make(chan *codec.Message, window),
+		more:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// send sends msg once the peer granted a credit for it. It returns io.EOF if
+// the stream ended.
+func (s *stream) send(msg any) error {
+	for {
+		s.mu.Lock()
+		if s.credits > 0 {
+			s.credits--
+			s.mu.Unlock()
+			break
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.more:
+		case <-s.done:
+			return io.EOF
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+	if s.finished() {
+		return io.EOF
+	}
+	return s.write(header.FrameStreamMessage, 0, msg)
+}
+
+// recvMsg decodes the next message into msg. Every half window of messages
+// read is granted back to the peer, while the stream lasts.
+func (s *stream) recvMsg(msg any) error {
+	var m *codec.Message
+	var ok bool
+	select {
+	case m, ok = <-s.recv:
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+	if !ok {
+		if s.recvErr != nil {
+			return s.recvErr
+		}
+		return io.EOF
+	}
+	if s.consumed++; s.consumed >= (s.window+1)/2 && !s.finished() {
+		if err := s.write(header.FrameWindowUpdate, uint32(s.consumed), nil); err != nil {
+			return err
+		}
+		s.consumed = 0
+	}
+	return m.Decode(msg)
+}
+
+// grant adds n credits for sending.
+func (s *stream) grant(n uint32) {
+	s.mu.Lock()
+	s.credits += int(n)
+	s.mu.Unlock()
+	select {
+	case s.more <- struct{}{}:
+	default:
+	}
+}
+
+// deliver queues a message read by the connection. A peer that exceeds its
+// window fails the receiving side of the stream.
+func (s *stream) deliver(m *codec.Message) {
+	if s.recvClosed {
+		return
+	}
+	select {
+	case s.recv <- m:
+	default:
+		s.closeRecv(errWindowExceeded)
+	}
+}
+
+// closeRecv makes Recv return err, or io.EOF if err is nil, once the queued
+// messages are read.
+func (s *stream) closeRecv(err error) {
+	if s.recvClosed {
+		return
+	}
+	s.recvClosed = true
+	s.recvErr = err
+	close(s.recv)
+}
+
+// finish stops the sending side of the stream.
+func (s *stream) finish() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *stream) finished() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ClientStream is the client side of a stream opened by Client.NewStream.
+// Send and Recv may be called from different goroutines, but neither of
+// them from several goroutines at once.
+type ClientStream struct {
+	*stream
+	client  *Client
+	id      uint64
+	sendMu  sync.Mutex
+	sendEnd bool
+}
+
+// Context returns the context of the stream.
+func (cs *ClientStream) Context() context.Context {
+	return cs.ctx
+}
+
+// Send sends msg to the server, blocking while the server is behind on
+// reading. It returns io.EOF once the stream ended, Recv then returns the
+// status of the stream.
+func (cs *ClientStream) Send(msg any) error {
+	cs.sendMu.Lock()
+	defer cs.sendMu.Unlock()
+	if cs.sendEnd {
+		return errSendClosed
+	}
+	return cs.send(msg)
+}
+
+// CloseSend tells the server that the client sends no more messages.
+func (cs *ClientStream) CloseSend() error {
+	cs.sendMu.Lock()
+	defer cs.sendMu.Unlock()
+	if cs.sendEnd {
+		return nil
+	}
+	cs.sendEnd = true
+	return cs.write(header.FrameHalfClose, 0, nil)
+}
+
+// Recv decodes the next message of the server into msg. It returns io.EOF
+// when the server ended the stream successfully, or the error of the stream.
+func (cs *ClientStream) Recv(msg any) error {
+	return cs.recvMsg(msg)
+}
+
+// Trailer returns the trailer sent by the server, it is available once Recv
+// returned an error.
+func (cs *ClientStream) Trailer() metadata.MD {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.trailer
+}
+
+// ServerStream is the server side of a stream, handlers of streaming methods
+// look like
+//
+//	func (t *T) Method(stream *tinyrpc.ServerStream) error
+//
+// The same handler serves server streaming, client streaming and
+// bidirectional calls, depending on how it uses Send and Recv. The stream
+// ends when the handler returns, with the status of the returned error.
+type ServerStream struct {
+	*stream
+}
+
+// Context returns the context of the call, it carries the deadline, the
+// metadata and the peer of the client like that of a unary call.
+func (ss *ServerStream) Context() context.Context {
+	return ss.ctx
+}
+
+// Send sends msg to the client, blocking while the client is behind on
+// reading.
+func (ss *ServerStream) Send(msg any) error {
+	return ss.send(msg)
+}
+
+// Recv decodes the next message of the client into msg. It returns io.EOF
+// once the client called CloseSend.
+func (ss *ServerStream) Recv(msg any) error {
+	return ss.recvMsg(msg)
+}
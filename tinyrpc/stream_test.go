@@ -0,0 +1,209 @@
+package tinyrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/braver-braver/tinyrpc/codec"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/metadata"
+	"github.com/braver-braver/tinyrpc/mock/message"
+	"github.com/braver-braver/tinyrpc/status"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Feed serves streams of ArithResponses.
+type Feed struct {
+	// sent counts the messages sent by Count
+	sent atomic.Int64
+}
+
+// Count sends A responses counting from 1.
+func (f *Feed) Count(stream *ServerStream) error {
+	args := &message.ArithRequest{}
+	if err := stream.Recv(args); err != nil {
+		return err
+	}
+	for i := 1; i <= int(args.A); i++ {
+		if err := stream.Send(&message.ArithResponse{C: float64(i)}); err != nil {
+			return err
+		}
+		f.sent.Add(1)
+	}
+	return nil
+}
+
+// Sum adds up the A of every request until the client closes its side.
+func (f *Feed) Sum(stream *ServerStream) error {
+	var sum float64
+	for {
+		args := &message.ArithRequest{}
+		err := stream.Recv(args)
+		if errors.Is(err, io.EOF) {
+			return stream.Send(&message.ArithResponse{C: sum})
+		}
+		if err != nil {
+			return err
+		}
+		sum += args.A
+	}
+}
+
+// Add answers every request with its sum.
+func (f *Feed) Add(stream *ServerStream) error {
+	for {
+		args := &message.ArithRequest{}
+		err := stream.Recv(args)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&message.ArithResponse{C: args.A + args.B}); err != nil {
+			return err
+		}
+	}
+}
+
+// Fail ends the stream with an error and a trailer.
+func (f *Feed) Fail(stream *ServerStream) error {
+	if err := SetTrailer(stream.Context(), metadata.Pairs("reason", "test")); err != nil {
+		return err
+	}
+	return status.Error(codes.FailedPrecondition, "feed failed")
+}
+
+func TestStream_Calls(t *testing.T) {
+	s, addr, _ := startServer(t, &Feed{}, WithStreamWindow(2))
+	defer s.Close()
+	client := dialClient(t, addr, WithStreamWindow(2))
+	defer client.Close()
+	ctx := context.Background()
+
+	// server streaming
+	cs, err := client.NewStream(ctx, "Feed.Count")
+	assert.NoError(t, err)
+	assert.NoError(t, cs.Send(&message.ArithRequest{A: 10}))
+	assert.NoError(t, cs.CloseSend())
+	for i := 1; i <= 10; i++ {
+		reply := &message.ArithResponse{}
+		assert.NoError(t, cs.Recv(reply))
+		assert.Equal(t, float64(i), reply.C)
+	}
+	assert.ErrorIs(t, cs.Recv(&message.ArithResponse{}), io.EOF)
+
+	// client streaming
+	cs, err = client.NewStream(ctx, "Feed.Sum")
+	assert.NoError(t, err)
+	for i := 1; i <= 10; i++ {
+		assert.NoError(t, cs.Send(&message.ArithRequest{A: float64(i)}))
+	}
+	assert.NoError(t, cs.CloseSend())
+	assert.ErrorIs(t, cs.Send(&message.ArithRequest{}), errSendClosed)
+	reply := &message.ArithResponse{}
+	assert.NoError(t, cs.Recv(reply))
+	assert.Equal(t, float64(55), reply.C)
+	assert.ErrorIs(t, cs.Recv(reply), io.EOF)
+
+	// bidirectional, with the sends racing the receives
+	cs, err = client.NewStream(ctx, "Feed.Add")
+	assert.NoError(t, err)
+	go func() {
+		for i := 0; i < 100; i++ {
+			_ = cs.Send(&message.ArithRequest{A: float64(i), B: 1})
+		}
+		_ = cs.CloseSend()
+	}()
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, cs.Recv(reply))
+		assert.Equal(t, float64(i+1), reply.C)
+	}
+	assert.ErrorIs(t, cs.Recv(reply), io.EOF)
+}
+
+func TestStream_FlowControl(t *testing.T) {
+	feed := &Feed{}
+	s, addr, _ := startServer(t, feed)
+	defer s.Close()
+	client := dialClient(t, addr, WithStreamWindow(3))
+	defer client.Close()
+
+	cs, err := client.NewStream(context.Background(), "Feed.Count")
+	assert.NoError(t, err)
+	assert.NoError(t, cs.Send(&message.ArithRequest{A: 20}))
+
+	// the server stops at the window while the client doesn't read
+	assert.Eventually(t, func() bool { return feed.sent.Load() == 3 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int64(3), feed.sent.Load())
+
+	for i := 1; i <= 20; i++ {
+		reply := &message.ArithResponse{}
+		assert.NoError(t, cs.Recv(reply))
+		assert.Equal(t, float64(i), reply.C)
+	}
+	assert.ErrorIs(t, cs.Recv(&message.ArithResponse{}), io.EOF)
+}
+
+func TestStream_Errors(t *testing.T) {
+	s, addr, _ := startServer(t, &Feed{})
+	defer s.Close()
+	assert.NoError(t, s.Register(&Arith{}))
+	client := dialClient(t, addr)
+	defer client.Close()
+	ctx := context.Background()
+
+	cs, err := client.NewStream(ctx, "Feed.Fail")
+	assert.NoError(t, err)
+	err = cs.Recv(&message.ArithResponse{})
+	assert.Equal(t, status.Error(codes.FailedPrecondition, "feed failed"), err)
+	assert.Equal(t, metadata.Pairs("reason", "test"), cs.Trailer())
+	assert.ErrorIs(t, cs.Send(&message.ArithRequest{}), io.EOF)
+
+	tests := []struct {
+		name          string
+		serviceMethod string
+		stream        bool
+	}{
+		{"unknown method", "Feed.Nope", true},
+		{"stream to unary method", "Arith.Add", true},
+		{"unary call to stream method", "Feed.Sum", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.stream {
+				var cs *ClientStream
+				cs, err = client.NewStream(ctx, tt.serviceMethod)
+				assert.NoError(t, err)
+				err = cs.Recv(&message.ArithResponse{})
+			} else {
+				err = client.Call(tt.serviceMethod, &message.ArithRequest{}, &message.ArithResponse{})
+			}
+			assert.Equal(t, codes.Unimplemented, status.Code(err))
+		})
+	}
+
+	// a cancelled stream stops waiting, the connection carries on
+	cctx, cancel := context.WithCancel(ctx)
+	cs, err = client.NewStream(cctx, "Feed.Sum")
+	assert.NoError(t, err)
+	cancel()
+	assert.ErrorIs(t, cs.Recv(&message.ArithResponse{}), context.Canceled)
+	reply := &message.ArithResponse{}
+	assert.NoError(t, client.Call("Arith.Add", &message.ArithRequest{A: 1, B: 2}, reply))
+	assert.Equal(t, float64(3), reply.C)
+}
+
+func TestStream_WindowExceeded(t *testing.T) {
+	s := newStream(context.Background(), 1, nil)
+	s.deliver(&codec.Message{})
+	assert.False(t, s.recvClosed)
+	s.deliver(&codec.Message{})
+	assert.True(t, s.recvClosed)
+	assert.ErrorIs(t, s.recvErr, errWindowExceeded)
+}
@@ -0,0 +1,152 @@
+package tinyrpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"github.com/braver-braver/tinyrpc/codes"
+	"github.com/braver-braver/tinyrpc/serializer"
+	"github.com/braver-braver/tinyrpc/status"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// Identity tells clients who the server thinks they are.
+type Identity struct{}
+
+func (Identity) Whoami(ctx context.Context, args *Blob, reply *Blob) error {
+	p, ok := PeerFromContext(ctx)
+	if !ok || p.Addr == nil {
+		return errors.New("no peer")
+	}
+	if cert := p.ClientCertificate(); cert != nil {
+		reply.Data = []byte(cert.Subject.CommonName)
+	}
+	return nil
+}
+
+// testCA issues certificates for the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tinyrpc test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate for the server at 127.0.0.1, or for a client
+// named cn.
+func (ca *testCA) issue(t *testing.T, cn string, server bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func startTLSServer(t *testing.T, config *tls.Config) (*Server, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := NewServer()
+	assert.NoError(t, s.Register(Identity{}))
+	go s.ServeTLS(lis, config)
+	return s, lis.Addr().String()
+}
+
+func TestServer_ServeTLS(t *testing.T) {
+	ca := newTestCA(t)
+	s, addr := startTLSServer(t, &tls.Config{Certificates: []tls.Certificate{ca.issue(t, "server", true)}})
+	defer s.Close()
+
+	client, err := Dial(addr, WithTLS(&tls.Config{RootCAs: ca.pool}), WithSerializer(serializer.MsgPack))
+	assert.NoError(t, err)
+	defer client.Close()
+	reply := &Blob{}
+	assert.NoError(t, client.Call("Identity.Whoami", &Blob{}, reply))
+	assert.Empty(t, reply.Data)
+
+	// the server is not trusted without the CA
+	assertDialFails(t, addr, WithTLS(&tls.Config{}))
+	// and doesn't speak plain tinyrpc
+	assertDialFails(t, addr)
+}
+
+func TestServer_ServeMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	s, addr := startTLSServer(t, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, "server", true)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	})
+	defer s.Close()
+
+	client, err := Dial(addr, WithTLS(&tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{ca.issue(t, "alice", false)},
+	}), WithSerializer(serializer.MsgPack))
+	assert.NoError(t, err)
+	defer client.Close()
+	reply := &Blob{}
+	assert.NoError(t, client.Call("Identity.Whoami", &Blob{}, reply))
+	assert.Equal(t, "alice", string(reply.Data))
+
+	// clients without a certificate, or with one from another CA, are refused
+	assertDialFails(t, addr, WithTLS(&tls.Config{RootCAs: ca.pool}))
+	other := newTestCA(t)
+	assertDialFails(t, addr, WithTLS(&tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{other.issue(t, "mallory", false)},
+	}))
+}
+
+// assertDialFails checks that a client dialing addr with opts can't connect.
+func assertDialFails(t *testing.T, addr string, opts ...Option) {
+	t.Helper()
+	client, err := Dial(addr, opts...)
+	assert.NoError(t, err)
+	defer client.Close()
+	err = client.Call("Identity.Whoami", &Blob{}, &Blob{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
@@ -0,0 +1,40 @@
+package tinyrpc
+
+import (
+	"context"
+	"errors"
+	"github.com/braver-braver/tinyrpc/metadata"
+	"sync"
+)
+
+type trailerKey struct{}
+
+// trailer collects the metadata a handler sends back with its response.
+type trailer struct {
+	mu sync.Mutex
+	md metadata.MD
+}
+
+// SetTrailer sets the trailer metadata that is sent back to the client along
+// with the response of the call. When called multiple times, all the
+// provided metadata will be merged. It fails if ctx is not the context of a
+// call handled by a tinyrpc server.
+func SetTrailer(ctx context.Context, md metadata.MD) error {
+	t, ok := ctx.Value(trailerKey{}).(*trailer)
+	if !ok {
+		return errors.New("tinyrpc: failed to fetch the call from context")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.md == nil {
+		t.md = metadata.MD{}
+	}
+	t.md.Join(md)
+	return nil
+}
+
+func (t *trailer) get() metadata.MD {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.md.Copy()
+}